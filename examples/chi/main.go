@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/middleware"
+)
+
+func main() {
+	// MetricsHub configuration
+	config := &metricshub.MetricsHubConfig{
+		ServiceName: "vm-operator-chi",
+		HostName:    "sprite-run-serverless-01",
+	}
+	mHub := metricshub.NewMetricsHub(config)
+
+	router := chi.NewRouter()
+	router.Use(middleware.NewChiMetricsCollector(mHub))
+
+	router.Handle("/metrics", mHub.HTTPHandler())
+	router.Get("/health/{component}", func(w http.ResponseWriter, r *http.Request) {
+		component := chi.URLParam(r, "component")
+		log.Printf("health check for component: %s", component)
+		fmt.Fprintln(w, "ok")
+	})
+
+	// Start the server
+	port := 8080
+	log.Printf("Serving metrics at :%d/metrics", port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	if err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
+}
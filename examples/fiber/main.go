@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/middleware"
+)
+
+func main() {
+	app := fiber.New()
+
+	// MetricsHub configuration
+	config := &metricshub.MetricsHubConfig{
+		ServiceName: "vm-operator-fiber",
+		HostName:    "sprite-run-serverless-01",
+	}
+	mHub := metricshub.NewMetricsHub(config)
+
+	app.Use(middleware.NewFiberMetricsCollector(mHub))
+
+	app.Get("/metrics", adaptor.HTTPHandler(mHub.HTTPHandler()))
+	app.Get("/health/:component", func(c *fiber.Ctx) error {
+		component := c.Params("component")
+		if component == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "component is required")
+		}
+		log.Printf("health check for component: %s", component)
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+
+	// Start the server
+	port := 8080
+	log.Printf("Serving metrics at :%d/metrics", port)
+	err := app.Listen(fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/megaease/metrics-go/metricshub"
+	grpcmetrics "github.com/megaease/metrics-go/middleware/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	// MetricsHub configuration
+	config := &metricshub.MetricsHubConfig{
+		ServiceName: "vm-operator-grpc",
+		HostName:    "sprite-run-serverless-01",
+	}
+	mHub := metricshub.NewMetricsHub(config)
+
+	// Serve the metrics over http
+	go func() {
+		log.Printf("Serving metrics at :8080/metrics")
+		http.Handle("/metrics", mHub.HTTPHandler())
+		if err := http.ListenAndServe(":8080", nil); err != nil {
+			log.Fatalf("failed to start metrics server: %v", err)
+		}
+	}()
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcmetrics.UnaryServerInterceptor(mHub)),
+		grpc.ChainStreamInterceptor(grpcmetrics.StreamServerInterceptor(mHub)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	// Start the server
+	port := 9090
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("Serving gRPC at :%d", port)
+	if err := server.Serve(lis); err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/middleware"
+)
+
+func main() {
+	// MetricsHub configuration
+	config := &metricshub.MetricsHubConfig{
+		ServiceName: "vm-operator-http",
+		HostName:    "sprite-run-serverless-01",
+	}
+	mHub := metricshub.NewMetricsHub(config)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", mHub.HTTPHandler())
+	mux.Handle("GET /stats", mHub.StatsHandler())
+	mux.HandleFunc("GET /health/{component}", func(w http.ResponseWriter, r *http.Request) {
+		component := r.PathValue("component")
+		log.Printf("health check for component: %s", component)
+		fmt.Fprintln(w, "ok")
+	})
+
+	// Start the server
+	port := 8080
+	log.Printf("Serving metrics at :%d/metrics", port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), middleware.NewHTTPMetricsHandler(mHub, mux))
+	if err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/middleware"
+)
+
+func main() {
+	// MetricsHub configuration
+	config := &metricshub.MetricsHubConfig{
+		ServiceName: "vm-operator-mux",
+		HostName:    "sprite-run-serverless-01",
+	}
+	mHub := metricshub.NewMetricsHub(config)
+
+	router := mux.NewRouter()
+	router.Use(middleware.NewMuxMetricsCollector(mHub))
+
+	router.Handle("/metrics", mHub.HTTPHandler())
+	router.HandleFunc("/health/{component}", func(w http.ResponseWriter, r *http.Request) {
+		component := mux.Vars(r)["component"]
+		log.Printf("health check for component: %s", component)
+		fmt.Fprintln(w, "ok")
+	}).Methods(http.MethodGet)
+
+	// Start the server
+	port := 8080
+	log.Printf("Serving metrics at :%d/metrics", port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	if err != nil {
+		log.Fatalf("failed to start server: %v", err)
+	}
+}
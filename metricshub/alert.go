@@ -0,0 +1,305 @@
+package metricshub
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+// The states of an alert.
+const (
+	// AlertStatePending means the condition is met, but not for the duration of the rule.
+	AlertStatePending AlertState = "pending"
+	// AlertStateFiring means the condition is met for the duration of the rule.
+	AlertStateFiring AlertState = "firing"
+	// AlertStateResolved means the condition of the firing alert is no longer met,
+	// it is kept until the next evaluation.
+	AlertStateResolved AlertState = "resolved"
+)
+
+type (
+	// AlertRule is the rule of the alerts evaluated every statistic tick (5s).
+	AlertRule struct {
+		// Name is the unique name of the rule.
+		Name string `yaml:"name" json:"name"`
+		// Expr is the condition of the rule in the form of
+		// `metric{label="value", ...} op threshold [for duration]`, e.g.
+		// `m1_err_percent{path="/api/v1/vm"} > 0.05 for 2m`.
+		//
+		// The metric is either the field of the route status in the snake case or
+		// the json name, e.g. "m1_err_percent", "p99", which is evaluated for every
+		// matched route labeled by direction, method, path, target and the extra
+		// labels, or a custom metric registered by RegisterMetric, which is read by
+		// GetMetricCurrentValue. The label matchers are "=", "!=", "=~" and "!~",
+		// the custom metrics only support "=". The operators are >, >=, <, <=, == and !=.
+		Expr string `yaml:"expr" json:"expr"`
+		// For is the duration the condition must be met before the alert is firing,
+		// the for clause of Expr takes precedence.
+		// Default is 0, which means the alert is firing immediately.
+		// +optional
+		For Duration `yaml:"for" json:"for"`
+		// RepeatInterval is the interval to notify the firing alert again.
+		// Default is 0, which means the firing alert is notified only once.
+		// +optional
+		RepeatInterval Duration `yaml:"repeatInterval" json:"repeatInterval"`
+		// Labels is the additional labels of the alerts.
+		// +optional
+		Labels map[string]string `yaml:"labels" json:"labels"`
+		// Annotations is the annotations of the alerts, e.g. "summary" and "description",
+		// they are text/template templates with .Labels and .Value.
+		// The summary and the description are sent in the notifications.
+		// +optional
+		Annotations map[string]string `yaml:"annotations" json:"annotations"`
+	}
+
+	// AlertState is the state of an alert.
+	AlertState string
+
+	// Alert is an alert of a rule, the alerts of a rule are distinguished by the labels.
+	Alert struct {
+		Rule        string            `json:"rule"`
+		State       AlertState        `json:"state"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+		Value       float64           `json:"value"`
+		// ActiveAt is the time the condition is met.
+		ActiveAt   time.Time `json:"activeAt"`
+		FiredAt    time.Time `json:"firedAt,omitempty"`
+		ResolvedAt time.Time `json:"resolvedAt,omitempty"`
+
+		notifiedAt time.Time
+	}
+
+	// alertRule is the compiled AlertRule.
+	alertRule struct {
+		AlertRule
+		expr        *alertExpr
+		annotations map[string]*template.Template
+	}
+
+	// alertSample is a value of the metric of a rule.
+	alertSample struct {
+		labels map[string]string
+		value  float64
+	}
+)
+
+// AddAlertRule adds the alert rule to the hub.
+func (hub *MetricsHub) AddAlertRule(rule AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("invalid alert rule: empty name")
+	}
+	expr, err := parseAlertExpr(rule.Expr)
+	if err != nil {
+		return fmt.Errorf("invalid alert rule %s: %v", rule.Name, err)
+	}
+	if expr.forDuration >= 0 {
+		rule.For = Duration(expr.forDuration)
+	}
+
+	r := &alertRule{
+		AlertRule:   rule,
+		expr:        expr,
+		annotations: make(map[string]*template.Template, len(rule.Annotations)),
+	}
+	for name, text := range rule.Annotations {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid annotation %s of alert rule %s: %v", name, rule.Name, err)
+		}
+		r.annotations[name] = tmpl
+	}
+
+	hub.alertsMutex.Lock()
+	defer hub.alertsMutex.Unlock()
+	if slices.ContainsFunc(hub.alertRules, func(r *alertRule) bool { return r.Name == rule.Name }) {
+		return fmt.Errorf("invalid alert rule %s: duplicated name", rule.Name)
+	}
+	hub.alertRules = append(hub.alertRules, r)
+	return nil
+}
+
+// Alerts returns the pending, firing and just resolved alerts, sorted by the rule and the labels.
+func (hub *MetricsHub) Alerts() []*Alert {
+	hub.alertsMutex.Lock()
+	defer hub.alertsMutex.Unlock()
+
+	keys := slices.Sorted(maps.Keys(hub.alerts))
+	result := make([]*Alert, 0, len(keys))
+	for _, key := range keys {
+		alert := *hub.alerts[key]
+		result = append(result, &alert)
+	}
+	return result
+}
+
+// evaluateAlerts evaluates the alert rules, and notifies the firing and the resolved alerts.
+func (hub *MetricsHub) evaluateAlerts(now time.Time) {
+	hub.alertsMutex.Lock()
+	rules := slices.Clone(hub.alertRules)
+	hub.alertsMutex.Unlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	samples := make(map[*alertRule][]alertSample, len(rules))
+	for _, rule := range rules {
+		samples[rule] = hub.alertSamples(rule.expr)
+	}
+
+	hub.alertsMutex.Lock()
+	defer hub.alertsMutex.Unlock()
+
+	for key, alert := range hub.alerts {
+		if alert.State == AlertStateResolved {
+			delete(hub.alerts, key)
+		}
+	}
+
+	active := make(map[string]bool)
+	for _, rule := range rules {
+		for _, sample := range samples[rule] {
+			if !rule.expr.compare(sample.value) {
+				continue
+			}
+			labels := maps.Clone(sample.labels)
+			maps.Copy(labels, rule.Labels)
+			key := rule.Name + "\x00" + labelsFingerprint(labels)
+			active[key] = true
+
+			alert, exists := hub.alerts[key]
+			if !exists {
+				alert = &Alert{
+					Rule:     rule.Name,
+					State:    AlertStatePending,
+					Labels:   labels,
+					ActiveAt: now,
+				}
+				hub.alerts[key] = alert
+			}
+			alert.Value = sample.value
+			alert.Annotations = rule.render(labels, sample.value)
+
+			switch {
+			case alert.State == AlertStatePending && now.Sub(alert.ActiveAt) >= time.Duration(rule.For):
+				alert.State = AlertStateFiring
+				alert.FiredAt = now
+				alert.notifiedAt = now
+				hub.notifyAlert(*alert)
+			case alert.State == AlertStateFiring && rule.RepeatInterval > 0 &&
+				now.Sub(alert.notifiedAt) >= time.Duration(rule.RepeatInterval):
+				alert.notifiedAt = now
+				hub.notifyAlert(*alert)
+			}
+		}
+	}
+
+	for key, alert := range hub.alerts {
+		if active[key] {
+			continue
+		}
+		if alert.State != AlertStateFiring {
+			delete(hub.alerts, key)
+			continue
+		}
+		alert.State = AlertStateResolved
+		alert.ResolvedAt = now
+		hub.notifyAlert(*alert)
+	}
+}
+
+// alertSamples returns the values of the metric of the expression.
+func (hub *MetricsHub) alertSamples(expr *alertExpr) []alertSample {
+	if expr.field == "" {
+		if _, exists := hub.registration(expr.metric); !exists {
+			return nil
+		}
+		labels := make(map[string]string, len(expr.matchers))
+		for _, m := range expr.matchers {
+			labels[m.name] = m.value
+		}
+		value, err := hub.GetMetricCurrentValue(expr.metric, maps.Clone(labels))
+		if err != nil {
+			log.Printf("get the value of %s failed: %v", expr.metric, err)
+			return nil
+		}
+		return []alertSample{{labels: labels, value: value}}
+	}
+
+	hub.httpStatsMutex.RLock()
+	defer hub.httpStatsMutex.RUnlock()
+
+	var samples []alertSample
+	for key, status := range hub.httpStatus {
+		// the labels of the sample are kept by the alert, so they are copied.
+		labels := maps.Clone(hub.httpStats[key].labels)
+		labels["direction"] = key.Direction
+		if !expr.match(labels) {
+			continue
+		}
+		value, _ := status.StatusField(expr.field)
+		samples = append(samples, alertSample{labels: labels, value: value})
+	}
+	return samples
+}
+
+// render renders the annotations of the alert, the failed ones are kept as is.
+func (r *alertRule) render(labels map[string]string, value float64) map[string]string {
+	if len(r.annotations) == 0 {
+		return nil
+	}
+	data := struct {
+		Labels map[string]string
+		Value  float64
+	}{labels, value}
+
+	result := make(map[string]string, len(r.annotations))
+	for name, tmpl := range r.annotations {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			result[name] = r.Annotations[name]
+			continue
+		}
+		result[name] = sb.String()
+	}
+	return result
+}
+
+func (hub *MetricsHub) notifyAlert(alert Alert) {
+	result := &Result{
+		UID:       "alert-" + alert.Rule + formatLabels(alert.Labels),
+		Title:     fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.State)), alert.Rule),
+		Status:    ResultStatusFailure,
+		Endpoint:  formatLabels(alert.Labels),
+		Message:   fmt.Sprintf("value is %g", alert.Value),
+		TimeStamp: fasttime.Now(),
+	}
+	if alert.State == AlertStateResolved {
+		result.Status = ResultStatusSuccess
+	}
+	if summary := alert.Annotations["summary"]; summary != "" {
+		result.Message = summary
+	}
+	if description := alert.Annotations["description"]; description != "" {
+		result.Message += "\n" + description
+	}
+	hub.notifyInOrder(result)
+}
+
+// labelsFingerprint returns the sorted labels as a comparable string.
+func labelsFingerprint(labels map[string]string) string {
+	var sb strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(labels[key])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
@@ -0,0 +1,151 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRules(t *testing.T) {
+	notified := make(chan string, 4)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		notified <- msg["text"].(string)
+	}))
+	defer slack.Close()
+
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:     "test",
+		SlackWebhookURL: slack.URL,
+		AlertRules: []AlertRule{{
+			Name:           "HighLatency",
+			Expr:           `tick_mean{path="/api/v1/vm"} > 100 for 10s`,
+			RepeatInterval: Duration(time.Minute),
+			Labels:         map[string]string{"severity": "page"},
+			Annotations:    map[string]string{"summary": "{{ .Labels.method }} {{ .Labels.path }} mean is {{ .Value }}ms"},
+		}},
+	})
+	assert.Error(t, hub.AddAlertRule(AlertRule{Name: "HighLatency", Expr: "p99 > 1"}))
+	assert.Error(t, hub.AddAlertRule(AlertRule{Name: "Invalid", Expr: "p99 >"}))
+	assert.Error(t, hub.AddAlertRule(AlertRule{Name: "InvalidAnnotation", Expr: "p99 > 1", Annotations: map[string]string{"summary": "{{"}}))
+
+	expectNotification := func(text string) {
+		t.Helper()
+		select {
+		case got := <-notified:
+			assert.Contains(t, got, text)
+		case <-time.After(time.Second):
+			t.Fatal("no notification")
+		}
+	}
+	expectNoNotification := func() {
+		t.Helper()
+		select {
+		case got := <-notified:
+			t.Fatalf("unexpected notification: %s", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	tick := func(at time.Time, duration time.Duration) {
+		if duration > 0 {
+			hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: duration}, "GET", "/api/v1/vm")
+		}
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: time.Second}, "GET", "/home")
+		hub.updateHTTPStatus()
+		hub.evaluateAlerts(at)
+	}
+
+	now := time.Now()
+	tick(now, 200*time.Millisecond)
+	alerts := hub.Alerts()
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, AlertStatePending, alerts[0].State)
+	assert.Equal(t, "page", alerts[0].Labels["severity"])
+	assert.Equal(t, "/api/v1/vm", alerts[0].Labels["path"])
+	assert.Equal(t, "server", alerts[0].Labels["direction"])
+	assert.Equal(t, float64(200), alerts[0].Value)
+	assert.Equal(t, "GET /api/v1/vm mean is 200ms", alerts[0].Annotations["summary"])
+	expectNoNotification()
+
+	tick(now.Add(10*time.Second), 300*time.Millisecond)
+	assert.Equal(t, AlertStateFiring, hub.Alerts()[0].State)
+	expectNotification("[FIRING] HighLatency ❌ - GET /api/v1/vm mean is 300ms")
+
+	// the firing alert is deduplicated until the repeat interval.
+	tick(now.Add(30*time.Second), 300*time.Millisecond)
+	expectNoNotification()
+	tick(now.Add(70*time.Second), 300*time.Millisecond)
+	expectNotification("[FIRING] HighLatency")
+
+	tick(now.Add(75*time.Second), 10*time.Millisecond)
+	alerts = hub.Alerts()
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, AlertStateResolved, alerts[0].State)
+	expectNotification("[RESOLVED] HighLatency ✅")
+
+	tick(now.Add(80*time.Second), 0)
+	assert.Empty(t, hub.Alerts())
+
+	// the pending alert is dropped silently.
+	tick(now.Add(85*time.Second), 200*time.Millisecond)
+	tick(now.Add(90*time.Second), 10*time.Millisecond)
+	assert.Empty(t, hub.Alerts())
+	expectNoNotification()
+}
+
+func TestAlertRuleCustomMetric(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{ServiceName: "test", DisableFixedLabels: true})
+	assert.NoError(t, hub.RegisterMetric(&MetricRegistration{
+		Name:      "queue_length",
+		Type:      MetricTypeGaugeVec,
+		Help:      "queue length",
+		LabelKeys: []string{"queue"},
+	}))
+	assert.NoError(t, hub.AddAlertRule(AlertRule{Name: "QueueTooLong", Expr: `queue_length{queue="jobs"} > 10`}))
+	assert.NoError(t, hub.AddAlertRule(AlertRule{Name: "Unknown", Expr: `unknown_metric > 10`}))
+
+	assert.NoError(t, hub.UpdateMetrics("queue_length", 5, map[string]string{"queue": "jobs"}))
+	assert.NoError(t, hub.UpdateMetrics("queue_length", 20, map[string]string{"queue": "mails"}))
+	hub.evaluateAlerts(time.Now())
+	assert.Empty(t, hub.Alerts())
+
+	assert.NoError(t, hub.UpdateMetrics("queue_length", 20, map[string]string{"queue": "jobs"}))
+	hub.evaluateAlerts(time.Now())
+	alerts := hub.Alerts()
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, AlertStateFiring, alerts[0].State)
+	assert.Equal(t, map[string]string{"queue": "jobs"}, alerts[0].Labels)
+	assert.Equal(t, float64(20), alerts[0].Value)
+}
+
+func TestAlertRuleCustomMetricConcurrentRegister(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{ServiceName: "test", DisableFixedLabels: true})
+	assert.NoError(t, hub.AddAlertRule(AlertRule{Name: "QueueTooLong", Expr: `queue_length_9 > 10`}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			hub.RegisterMetric(&MetricRegistration{
+				Name: fmt.Sprintf("queue_length_%d", i),
+				Type: MetricTypeGaugeVec,
+				Help: "queue length",
+			})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		hub.evaluateAlerts(time.Now())
+		hub.CurrentMetrics()
+	}
+	<-done
+
+	assert.NoError(t, hub.UpdateMetrics("queue_length_9", 20, nil))
+	hub.evaluateAlerts(time.Now())
+	assert.Len(t, hub.Alerts(), 1)
+}
@@ -0,0 +1,218 @@
+package metricshub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type (
+	// alertExpr is the parsed expression of an alert rule, in the form of
+	// `metric{label="value", ...} op threshold [for duration]`.
+	alertExpr struct {
+		metric string
+		// field is the json name of the StatisticsMetric field if the metric
+		// is a route status field, otherwise it is a custom metric.
+		field     string
+		matchers  []labelMatcher
+		op        string
+		threshold float64
+		// forDuration is the duration of the for clause, -1 if there is no for clause.
+		forDuration time.Duration
+	}
+
+	// labelMatcher matches a label by "=", "!=", "=~" or "!~".
+	labelMatcher struct {
+		name  string
+		op    string
+		value string
+		re    *regexp.Regexp
+	}
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+	// the longer operators must be matched first.
+	comparisonOps = []string{">=", "<=", "==", "!=", ">", "<"}
+	matcherOps    = []string{"=~", "!~", "!=", "="}
+)
+
+// parseAlertExpr parses the expression of an alert rule, e.g.
+// `m1_err_percent{path="/api/v1/vm"} > 0.05 for 2m`.
+func parseAlertExpr(s string) (*alertExpr, error) {
+	expr := &alertExpr{forDuration: -1}
+	rest := strings.TrimSpace(s)
+
+	expr.metric = metricNameRe.FindString(rest)
+	if expr.metric == "" {
+		return nil, fmt.Errorf("invalid alert expression %q: missing metric name", s)
+	}
+	expr.field = statusFieldName(expr.metric)
+	rest = strings.TrimSpace(rest[len(expr.metric):])
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		expr.matchers, rest, err = parseLabelMatchers(rest[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert expression %q: %v", s, err)
+		}
+		if expr.field == "" {
+			for _, m := range expr.matchers {
+				if m.op != "=" {
+					return nil, fmt.Errorf("invalid alert expression %q: custom metric only supports \"=\" matchers", s)
+				}
+			}
+		}
+	}
+
+	for _, op := range comparisonOps {
+		if strings.HasPrefix(rest, op) {
+			expr.op = op
+			break
+		}
+	}
+	if expr.op == "" {
+		return nil, fmt.Errorf("invalid alert expression %q: missing comparison operator", s)
+	}
+	rest = strings.TrimSpace(rest[len(expr.op):])
+
+	value, forClause, _ := strings.Cut(rest, " ")
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert expression %q: invalid threshold %q", s, value)
+	}
+	expr.threshold = threshold
+
+	forClause = strings.TrimSpace(forClause)
+	if forClause != "" {
+		duration, found := strings.CutPrefix(forClause, "for ")
+		if !found {
+			return nil, fmt.Errorf("invalid alert expression %q: unexpected %q", s, forClause)
+		}
+		expr.forDuration, err = time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert expression %q: %v", s, err)
+		}
+	}
+
+	return expr, nil
+}
+
+// parseLabelMatchers parses the label matchers after "{", and returns the rest after "}".
+func parseLabelMatchers(s string) ([]labelMatcher, string, error) {
+	var matchers []labelMatcher
+	for {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "}") {
+			return matchers, strings.TrimSpace(s[1:]), nil
+		}
+
+		m := labelMatcher{name: labelNameRe.FindString(s)}
+		if m.name == "" {
+			return nil, "", fmt.Errorf("invalid label matcher at %q", s)
+		}
+		s = strings.TrimSpace(s[len(m.name):])
+		for _, op := range matcherOps {
+			if strings.HasPrefix(s, op) {
+				m.op = op
+				break
+			}
+		}
+		if m.op == "" {
+			return nil, "", fmt.Errorf("invalid label matcher operator at %q", s)
+		}
+		s = strings.TrimSpace(s[len(m.op):])
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid label value at %q", s)
+		}
+		m.value, _ = strconv.Unquote(quoted)
+		s = strings.TrimSpace(s[len(quoted):])
+		if m.op == "=~" || m.op == "!~" {
+			m.re, err = regexp.Compile("^(?:" + m.value + ")$")
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid label regexp %q: %v", m.value, err)
+			}
+		}
+		matchers = append(matchers, m)
+
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return nil, "", fmt.Errorf("missing \"}\" at %q", s)
+		}
+	}
+}
+
+// statusFieldName returns the json name of the StatisticsMetric field of the metric,
+// the snake case names are converted, e.g. "m1_err_percent" to "m1ErrPercent".
+// It returns empty if the metric is not a status field.
+func statusFieldName(metric string) string {
+	if _, exists := statusFields[metric]; exists {
+		return metric
+	}
+	var sb strings.Builder
+	upper := false
+	for _, r := range metric {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			sb.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if _, exists := statusFields[sb.String()]; exists {
+		return sb.String()
+	}
+	return ""
+}
+
+// match returns true if the labels match all the matchers, the missing labels are empty.
+func (e *alertExpr) match(labels map[string]string) bool {
+	for _, m := range e.matchers {
+		if !m.match(labels[m.name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *labelMatcher) match(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// compare returns true if the value satisfies the condition.
+func (e *alertExpr) compare(value float64) bool {
+	switch e.op {
+	case ">":
+		return value > e.threshold
+	case ">=":
+		return value >= e.threshold
+	case "<":
+		return value < e.threshold
+	case "<=":
+		return value <= e.threshold
+	case "==":
+		return value == e.threshold
+	default:
+		return value != e.threshold
+	}
+}
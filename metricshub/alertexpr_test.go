@@ -0,0 +1,52 @@
+package metricshub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlertExpr(t *testing.T) {
+	expr, err := parseAlertExpr(`m1_err_percent{path="/api/v1/vm", method=~"GET|POST"} > 0.05 for 2m`)
+	assert.NoError(t, err)
+	assert.Equal(t, "m1ErrPercent", expr.field)
+	assert.Equal(t, ">", expr.op)
+	assert.Equal(t, 0.05, expr.threshold)
+	assert.Equal(t, 2*time.Minute, expr.forDuration)
+	assert.True(t, expr.match(map[string]string{"path": "/api/v1/vm", "method": "POST"}))
+	assert.False(t, expr.match(map[string]string{"path": "/api/v1/vm", "method": "DELETE"}))
+	assert.True(t, expr.compare(0.06))
+	assert.False(t, expr.compare(0.05))
+
+	expr, err = parseAlertExpr(`p99 >= 500`)
+	assert.NoError(t, err)
+	assert.Equal(t, "p99", expr.field)
+	assert.Equal(t, time.Duration(-1), expr.forDuration)
+	assert.True(t, expr.compare(500))
+
+	expr, err = parseAlertExpr(`gpu_temperature{node="ds01"} != 0`)
+	assert.NoError(t, err)
+	assert.Equal(t, "", expr.field)
+	assert.Equal(t, "gpu_temperature", expr.metric)
+
+	expr, err = parseAlertExpr(`tick_mean{path!~"/static/.*"} < 1`)
+	assert.NoError(t, err)
+	assert.True(t, expr.match(map[string]string{"path": "/vm"}))
+	assert.False(t, expr.match(map[string]string{"path": "/static/a.js"}))
+
+	for _, s := range []string{
+		``,
+		`p99`,
+		`p99 > abc`,
+		`p99 > 1 after 2m`,
+		`p99 > 1 for 2x`,
+		`p99{path="/vm" > 1`,
+		`p99{path=/vm} > 1`,
+		`p99{path=~"("} > 1`,
+		`gpu_temperature{node!="ds01"} > 1`,
+	} {
+		_, err := parseAlertExpr(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,117 @@
+package metricshub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The kinds of the long-lived connections.
+const (
+	// ConnectionWebSocket is the WebSocket connection.
+	ConnectionWebSocket = "websocket"
+	// ConnectionSSE is the Server-Sent Events stream.
+	ConnectionSSE = "sse"
+	// ConnectionUpgrade is the connection upgraded to the other protocols.
+	ConnectionUpgrade = "upgrade"
+)
+
+type (
+	// Connection tracks a long-lived connection, e.g. WebSocket and SSE, which is
+	// collected as an active connection rather than a request, so it doesn't skew
+	// the request latency. The methods of the nil Connection do nothing.
+	Connection struct {
+		startAt time.Time
+		once    sync.Once
+
+		active           prometheus.Gauge
+		duration         prometheus.Observer
+		messagesSent     prometheus.Counter
+		messagesReceived prometheus.Counter
+		bytesSent        prometheus.Counter
+		bytesReceived    prometheus.Counter
+	}
+
+	// connectionRef is the connection of a request carried by the context.
+	connectionRef struct {
+		conn atomic.Pointer[Connection]
+	}
+
+	connectionKey struct{}
+)
+
+// TrackConnection marks a long-lived connection of the route is opened, Close must be
+// called when it is closed. The kind is one of ConnectionWebSocket, ConnectionSSE and
+// ConnectionUpgrade. It returns nil if the route is excluded.
+// Do not call this method directly, use the middleware instead.
+func (hub *MetricsHub) TrackConnection(kind, path string) *Connection {
+	if hub.IsExcludedHttpPath(path) {
+		return nil
+	}
+
+	m := hub.httpMetrics
+	labels := prometheus.Labels{"path": path, "kind": kind}
+	c := &Connection{
+		startAt:          fasttime.Now(),
+		active:           m.ActiveConnections.With(labels),
+		duration:         m.ConnectionDuration.With(labels),
+		messagesSent:     m.ConnectionMessagesSent.With(labels),
+		messagesReceived: m.ConnectionMessagesReceived.With(labels),
+		bytesSent:        m.ConnectionBytesSent.With(labels),
+		bytesReceived:    m.ConnectionBytesReceived.With(labels),
+	}
+	m.Connections.With(labels).Inc()
+	c.active.Inc()
+	return c
+}
+
+// AddSent counts the messages and bytes sent by the connection.
+func (c *Connection) AddSent(messages, bytes int) {
+	if c == nil {
+		return
+	}
+	c.messagesSent.Add(float64(messages))
+	c.bytesSent.Add(float64(bytes))
+}
+
+// AddReceived counts the messages and bytes received by the connection.
+func (c *Connection) AddReceived(messages, bytes int) {
+	if c == nil {
+		return
+	}
+	c.messagesReceived.Add(float64(messages))
+	c.bytesReceived.Add(float64(bytes))
+}
+
+// Close marks the connection is closed, it could be called multiple times.
+func (c *Connection) Close() {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() {
+		c.active.Dec()
+		c.duration.Observe(fasttime.Since(c.startAt).Seconds())
+	})
+}
+
+// WithConnection returns a copy of the context carrying the connection set later by
+// the returned function. It is used by the middlewares to pass the connection to the
+// handlers, the connection is opened when the request is upgraded by the handler.
+func WithConnection(ctx context.Context) (context.Context, func(c *Connection)) {
+	ref := &connectionRef{}
+	return context.WithValue(ctx, connectionKey{}, ref), ref.conn.Store
+}
+
+// ConnectionFromContext returns the connection of the context, or nil if there is
+// none or the request is not upgraded yet.
+func ConnectionFromContext(ctx context.Context) *Connection {
+	ref, _ := ctx.Value(connectionKey{}).(*connectionRef)
+	if ref == nil {
+		return nil
+	}
+	return ref.conn.Load()
+}
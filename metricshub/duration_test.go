@@ -0,0 +1,72 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	var d Duration
+	assert.NoError(t, json.Unmarshal([]byte(`"300ms"`), &d))
+	assert.Equal(t, Duration(300*time.Millisecond), d)
+	assert.NoError(t, json.Unmarshal([]byte(`60000000000`), &d))
+	assert.Equal(t, Duration(time.Minute), d)
+	assert.NoError(t, json.Unmarshal([]byte(`null`), &d))
+	assert.Equal(t, Duration(time.Minute), d)
+	assert.Error(t, json.Unmarshal([]byte(`"1x"`), &d))
+	assert.Error(t, json.Unmarshal([]byte(`1.5`), &d))
+
+	b, err := json.Marshal(Duration(90 * time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, `"1m30s"`, string(b))
+
+	// the unmarshal function of yaml decodes the numbers into int64 and the others into string.
+	yamlUnmarshal := func(value any) func(any) error {
+		return func(v any) error {
+			b, _ := json.Marshal(value)
+			return json.Unmarshal(b, v)
+		}
+	}
+	assert.NoError(t, d.UnmarshalYAML(yamlUnmarshal("5m")))
+	assert.Equal(t, Duration(5*time.Minute), d)
+	assert.NoError(t, d.UnmarshalYAML(yamlUnmarshal(1000)))
+	assert.Equal(t, Duration(time.Microsecond), d)
+	assert.Error(t, d.UnmarshalYAML(yamlUnmarshal("5")))
+}
+
+func TestConfigDurationsJSON(t *testing.T) {
+	config := &MetricsHubConfig{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"latencyWindows": ["1m", 300000000000],
+		"apdexTarget": "250ms",
+		"routeApdexTargets": [{"pattern": "/reports/**", "target": "2s"}],
+		"alertRules": [{"name": "slow", "expr": "p99 > 100", "for": "30s", "repeatInterval": 3600000000000}],
+		"sampleCapture": {"slowThreshold": "300ms", "window": "10m", "notifyThreshold": "2s", "notifyInterval": 60000000000}
+	}`), config))
+	assert.Equal(t, []Duration{Duration(time.Minute), Duration(5 * time.Minute)}, config.LatencyWindows)
+	assert.Equal(t, &SampleCaptureConfig{
+		SlowThreshold:   Duration(300 * time.Millisecond),
+		Window:          Duration(10 * time.Minute),
+		NotifyThreshold: Duration(2 * time.Second),
+		NotifyInterval:  Duration(time.Minute),
+	}, config.SampleCapture)
+	assert.Equal(t, Duration(250*time.Millisecond), config.ApdexTarget)
+	assert.Equal(t, []ApdexTargetRule{{Pattern: "/reports/**", Target: Duration(2 * time.Second)}}, config.RouteApdexTargets)
+	if assert.Len(t, config.AlertRules, 1) {
+		assert.Equal(t, Duration(30*time.Second), config.AlertRules[0].For)
+		assert.Equal(t, Duration(time.Hour), config.AlertRules[0].RepeatInterval)
+	}
+
+	b, err := json.Marshal(config)
+	assert.NoError(t, err)
+	decoded := &MetricsHubConfig{}
+	assert.NoError(t, json.Unmarshal(b, decoded))
+	assert.Equal(t, config.LatencyWindows, decoded.LatencyWindows)
+	assert.Equal(t, config.SampleCapture, decoded.SampleCapture)
+	assert.Equal(t, config.ApdexTarget, decoded.ApdexTarget)
+	assert.Equal(t, config.RouteApdexTargets, decoded.RouteApdexTargets)
+	assert.Equal(t, config.AlertRules, decoded.AlertRules)
+}
@@ -8,14 +8,27 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	counterMap   = make(map[string]*prometheus.CounterVec)
-	gaugeMap     = make(map[string]*prometheus.GaugeVec)
-	histogramMap = make(map[string]*prometheus.HistogramVec)
-	summaryMap   = make(map[string]*prometheus.SummaryVec)
-	lock         = sync.Mutex{}
+type (
+	// metricVecs caches the metric vecs created by a hub, they are registered
+	// to the registry of the hub, so they must not be shared between hubs.
+	metricVecs struct {
+		lock       sync.Mutex
+		counters   map[string]*prometheus.CounterVec
+		gauges     map[string]*prometheus.GaugeVec
+		histograms map[string]*prometheus.HistogramVec
+		summaries  map[string]*prometheus.SummaryVec
+	}
 )
 
+func newMetricVecs() *metricVecs {
+	return &metricVecs{
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		summaries:  make(map[string]*prometheus.SummaryVec),
+	}
+}
+
 var (
 	validMetric = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
 	validLabel  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
@@ -23,70 +36,70 @@ var (
 
 // NewCounterVec creates a counter metric vec.
 func (hub *MetricsHub) NewCounterVec(name string, help string, labels []string) *prometheus.CounterVec {
-	lock.Lock()
-	defer lock.Unlock()
+	hub.vecs.lock.Lock()
+	defer hub.vecs.lock.Unlock()
 
 	metricName, err := getAndValidate(name, labels)
 	if err != nil {
 		return nil
 	}
 
-	if m, find := counterMap[metricName]; find {
+	if m, find := hub.vecs.counters[metricName]; find {
 		return m
 	}
 
-	counterMap[metricName] = prometheus.NewCounterVec(
+	hub.vecs.counters[metricName] = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: metricName,
 			Help: help,
 		},
 		labels,
 	)
-	hub.registry.MustRegister(counterMap[metricName])
+	hub.registry.MustRegister(hub.vecs.counters[metricName])
 
-	return counterMap[metricName]
+	return hub.vecs.counters[metricName]
 }
 
 // NewGaugeVec creates a gauge metric vec.
 func (hub *MetricsHub) NewGaugeVec(name string, help string, labels []string) *prometheus.GaugeVec {
-	lock.Lock()
-	defer lock.Unlock()
+	hub.vecs.lock.Lock()
+	defer hub.vecs.lock.Unlock()
 
 	metricName, err := getAndValidate(name, labels)
 	if err != nil {
 		return nil
 	}
 
-	if m, find := gaugeMap[metricName]; find {
+	if m, find := hub.vecs.gauges[metricName]; find {
 		return m
 	}
-	gaugeMap[metricName] = prometheus.NewGaugeVec(
+	hub.vecs.gauges[metricName] = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: metricName,
 			Help: help,
 		},
 		labels,
 	)
-	hub.registry.MustRegister(gaugeMap[metricName])
+	hub.registry.MustRegister(hub.vecs.gauges[metricName])
 
-	return gaugeMap[metricName]
+	return hub.vecs.gauges[metricName]
 }
 
 // NewHistogramVec creates a Histogram metric vec.
 // Export more opts if needed in future.
 func (hub *MetricsHub) NewHistogramVec(name, help string, labels []string, buckets []float64) *prometheus.HistogramVec {
-	lock.Lock()
-	defer lock.Unlock()
+	hub.vecs.lock.Lock()
+	defer hub.vecs.lock.Unlock()
 
 	metricName, err := getAndValidate(name, labels)
 	if err != nil {
 		return nil
 	}
 
-	if m, find := histogramMap[metricName]; find {
+	if m, find := hub.vecs.histograms[metricName]; find {
 		return m
 	}
-	histogramMap[metricName] = prometheus.NewHistogramVec(
+	hub.vecs.histograms[metricName] = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    metricName,
 			Help:    help,
@@ -94,26 +107,26 @@ func (hub *MetricsHub) NewHistogramVec(name, help string, labels []string, bucke
 		},
 		labels,
 	)
-	hub.registry.MustRegister(histogramMap[metricName])
+	hub.registry.MustRegister(hub.vecs.histograms[metricName])
 
-	return histogramMap[metricName]
+	return hub.vecs.histograms[metricName]
 }
 
 // NewSummaryVec creates a Summary metric vec.
 // Export more opts if needed in future.
 func (hub *MetricsHub) NewSummaryVec(name, help string, labels []string, objectives map[float64]float64) *prometheus.SummaryVec {
-	lock.Lock()
-	defer lock.Unlock()
+	hub.vecs.lock.Lock()
+	defer hub.vecs.lock.Unlock()
 
 	metricName, err := getAndValidate(name, labels)
 	if err != nil {
 		return nil
 	}
 
-	if m, find := summaryMap[metricName]; find {
+	if m, find := hub.vecs.summaries[metricName]; find {
 		return m
 	}
-	summaryMap[metricName] = prometheus.NewSummaryVec(
+	hub.vecs.summaries[metricName] = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name:       metricName,
 			Help:       help,
@@ -121,9 +134,9 @@ func (hub *MetricsHub) NewSummaryVec(name, help string, labels []string, objecti
 		},
 		labels,
 	)
-	hub.registry.MustRegister(summaryMap[metricName])
+	hub.registry.MustRegister(hub.vecs.summaries[metricName])
 
-	return summaryMap[metricName]
+	return hub.vecs.summaries[metricName]
 }
 
 func getAndValidate(name string, labels []string) (string, error) {
@@ -154,6 +167,11 @@ func DefaultDurationBuckets() []float64 {
 	return []float64{10, 50, 100, 200, 400, 800, 1000, 2000, 4000, 8000}
 }
 
+// DefaultConnectionDurationBuckets returns default long-lived connection duration buckets in seconds
+func DefaultConnectionDurationBuckets() []float64 {
+	return []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 14400}
+}
+
 // DefaultBodySizeBuckets returns default body size buckets in bytes
 func DefaultBodySizeBuckets() []float64 {
 	return prometheus.ExponentialBucketsRange(200, 400000, 10)
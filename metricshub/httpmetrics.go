@@ -1,7 +1,9 @@
 package metricshub
 
 import (
-	"os"
+	"maps"
+	"slices"
+	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -13,15 +15,55 @@ const (
 type (
 	// httpRequestMetrics is the statistics tool for HTTP traffic.
 	httpRequestMetrics struct {
+		collapseStatusCodes bool
+
 		TotalRequests               *prometheus.CounterVec
 		TotalResponses              *prometheus.CounterVec
 		TotalErrorRequests          *prometheus.CounterVec
+		TotalClientErrorRequests    *prometheus.CounterVec
+		TotalServerErrorRequests    *prometheus.CounterVec
+		TotalResponsesByCode        *prometheus.CounterVec
+		OverflowRequests            prometheus.Counter
+		Panics                      *prometheus.CounterVec
+		Failures                    *prometheus.CounterVec
+		DNSDuration                 prometheus.ObserverVec
+		ConnectDuration             prometheus.ObserverVec
+		TLSHandshakeDuration        prometheus.ObserverVec
+		FirstByteDuration           prometheus.ObserverVec
+		ServiceInFlight             prometheus.Gauge
+		ServicePeakConcurrency      prometheus.Gauge
+		ServiceConcurrency          prometheus.Gauge
+		ServiceUtilization          prometheus.Gauge
+		SLOEvents                   *prometheus.CounterVec
+		SLOGoodEvents               *prometheus.CounterVec
+		SLOObjective                *prometheus.GaugeVec
+		SLOErrorBudgetRemaining     *prometheus.GaugeVec
+		SLOBurnRate                 *prometheus.GaugeVec
+		SLOBurnRateAlerts           *prometheus.GaugeVec
+		ActiveConnections           *prometheus.GaugeVec
+		Connections                 *prometheus.CounterVec
+		ConnectionDuration          prometheus.ObserverVec
+		ConnectionMessagesSent      *prometheus.CounterVec
+		ConnectionMessagesReceived  *prometheus.CounterVec
+		ConnectionBytesSent         *prometheus.CounterVec
+		ConnectionBytesReceived     *prometheus.CounterVec
+		ServerConnections           *prometheus.GaugeVec
+		ServerConnectionsTotal      *prometheus.CounterVec
+		ServerConnectionDuration    prometheus.Observer
+		ServerConnectionRequests    prometheus.Observer
+		AcceptErrors                prometheus.Counter
+		ServerTLSHandshakes         *prometheus.CounterVec
+		ServerTLSHandshakeFailures  prometheus.Counter
+		ServerTLSHandshakeDuration  prometheus.ObserverVec
 		RequestsDuration            prometheus.ObserverVec
 		RequestSizeBytes            prometheus.ObserverVec
 		ResponseSizeBytes           prometheus.ObserverVec
 		RequestsDurationPercentage  prometheus.ObserverVec
 		RequestSizeBytesPercentage  prometheus.ObserverVec
 		ResponseSizeBytesPercentage prometheus.ObserverVec
+		ResponseUncompressedBytes   prometheus.ObserverVec
+		TTFBDuration                prometheus.ObserverVec
+		QueueDuration               prometheus.ObserverVec
 
 		M1            *prometheus.GaugeVec
 		M5            *prometheus.GaugeVec
@@ -29,12 +71,26 @@ type (
 		M1Err         *prometheus.GaugeVec
 		M5Err         *prometheus.GaugeVec
 		M15Err        *prometheus.GaugeVec
+		M1ClientErr   *prometheus.GaugeVec
+		M5ClientErr   *prometheus.GaugeVec
+		M15ClientErr  *prometheus.GaugeVec
+		M1ServerErr   *prometheus.GaugeVec
+		M5ServerErr   *prometheus.GaugeVec
+		M15ServerErr  *prometheus.GaugeVec
 		M1ErrPercent  *prometheus.GaugeVec
 		M5ErrPercent  *prometheus.GaugeVec
 		M15ErrPercent *prometheus.GaugeVec
 		Min           *prometheus.GaugeVec
 		Max           *prometheus.GaugeVec
 		Mean          *prometheus.GaugeVec
+		TickMin       *prometheus.GaugeVec
+		TickMax       *prometheus.GaugeVec
+		TickMean      *prometheus.GaugeVec
+		WindowMin     *prometheus.GaugeVec
+		WindowMax     *prometheus.GaugeVec
+		WindowMean    *prometheus.GaugeVec
+		Apdex         *prometheus.GaugeVec
+		WindowApdex   *prometheus.GaugeVec
 		P25           *prometheus.GaugeVec
 		P50           *prometheus.GaugeVec
 		P75           *prometheus.GaugeVec
@@ -44,179 +100,502 @@ type (
 		P999          *prometheus.GaugeVec
 		ReqSize       *prometheus.GaugeVec
 		RespSize      *prometheus.GaugeVec
+
+		RespUncompressedSize *prometheus.GaugeVec
+
+		InFlight        *prometheus.GaugeVec
+		PeakConcurrency *prometheus.GaugeVec
+		Concurrency     *prometheus.GaugeVec
+		Utilization     *prometheus.GaugeVec
+
+		TTFBMean  *prometheus.GaugeVec
+		TTFBP50   *prometheus.GaugeVec
+		TTFBP95   *prometheus.GaugeVec
+		TTFBP99   *prometheus.GaugeVec
+		QueueMean *prometheus.GaugeVec
+		QueueP50  *prometheus.GaugeVec
+		QueueP95  *prometheus.GaugeVec
+		QueueP99  *prometheus.GaugeVec
 	}
 )
 
-// newHTTPMetrics create the HttpServerMetrics.
-func (hub *MetricsHub) newHTTPMetrics() *httpRequestMetrics {
-	commonLabels := prometheus.Labels{
-		"service_name": hub.config.ServiceName,
-		"type":         httpMetricsType,
-	}
-	httpserverLabels := []string{"service_name", "method", "path", "type"}
-	if hub.config.EnableHostNameLabel {
-		httpserverLabels = append(httpserverLabels, "host_name")
-		if hub.config.HostName == "" {
-			hostname, _ := os.Hostname()
-			hub.config.HostName = hostname
-		}
-		commonLabels["host_name"] = hub.config.HostName
-	}
-	if hub.config.Labels != nil {
-		for k, v := range hub.config.Labels {
-			commonLabels[k] = v
-			httpserverLabels = append(httpserverLabels, k)
+// newHTTPMetrics create the HttpServerMetrics of the direction. The metrics of both
+// directions are in the same families labeled by the direction, the server direction
+// is labeled by the extra labels and the client direction by the target, which are
+// empty for the other direction. The metrics of the concepts of the server, e.g. the
+// in-flight requests and the utilization, are only created for the server direction.
+func (hub *MetricsHub) newHTTPMetrics(direction string) *httpRequestMetrics {
+	commonLabels := hub.CommonLabels(httpMetricsType)
+	hubLabels := slices.Sorted(maps.Keys(commonLabels))
+	serverLabels := append(append([]string{"method", "path"}, hubLabels...), hub.extraLabelKeys...)
+	httpserverLabels := append(slices.Clone(serverLabels), "direction", "target")
+	sharedLabels := maps.Clone(commonLabels)
+	sharedLabels["direction"] = direction
+	if direction == DirectionClient {
+		for _, key := range hub.extraLabelKeys {
+			sharedLabels[key] = ""
 		}
+	} else {
+		sharedLabels["target"] = ""
 	}
 
-	return &httpRequestMetrics{
+	windowLabels := append(slices.Clone(httpserverLabels), "window")
+	codeLabels := append(slices.Clone(httpserverLabels), "code", "class")
+
+	m := &httpRequestMetrics{
+		collapseStatusCodes: hub.config.CollapseStatusCodes,
+
 		TotalRequests: hub.NewCounterVec(
 			"total_requests",
 			"the total count of http requests",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		TotalResponses: hub.NewCounterVec(
 			"total_responses",
 			"the total count of http responses",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		TotalErrorRequests: hub.NewCounterVec(
 			"total_error_requests",
 			"the total count of http error requests",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TotalClientErrorRequests: hub.NewCounterVec(
+			"total_client_error_requests",
+			"the total count of http client error requests",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TotalServerErrorRequests: hub.NewCounterVec(
+			"total_server_error_requests",
+			"the total count of http server error requests",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TotalResponsesByCode: hub.NewCounterVec(
+			"http_responses_total",
+			"the total count of http responses by status code and status class",
+			codeLabels).MustCurryWith(sharedLabels),
 		RequestsDuration: hub.NewHistogramVec(
 			"requests_duration",
 			"request processing duration histogram of a backend",
 			httpserverLabels,
-			DefaultDurationBuckets()).MustCurryWith(commonLabels),
+			DefaultDurationBuckets()).MustCurryWith(sharedLabels),
 		RequestSizeBytes: hub.NewHistogramVec(
 			"requests_size_bytes",
 			"a histogram of the total size of the request to a backend. Includes body",
 			httpserverLabels,
-			DefaultBodySizeBuckets()).MustCurryWith(commonLabels),
+			DefaultBodySizeBuckets()).MustCurryWith(sharedLabels),
 		ResponseSizeBytes: hub.NewHistogramVec(
 			"responses_size_bytes",
 			"a histogram of the total size of the returned response body from a backend",
 			httpserverLabels,
-			DefaultBodySizeBuckets()).MustCurryWith(commonLabels),
+			DefaultBodySizeBuckets()).MustCurryWith(sharedLabels),
 		RequestsDurationPercentage: hub.NewSummaryVec(
 			"requests_duration_percentage",
 			"request processing duration summary of a backend",
 			httpserverLabels,
-			DefaultObjectives()).MustCurryWith(commonLabels),
+			DefaultObjectives()).MustCurryWith(sharedLabels),
 		RequestSizeBytesPercentage: hub.NewSummaryVec(
 			"requests_size_bytes_percentage",
 			"a summary of the total size of the request to a backend. Includes body",
 			httpserverLabels,
-			DefaultObjectives()).MustCurryWith(commonLabels),
+			DefaultObjectives()).MustCurryWith(sharedLabels),
 		ResponseSizeBytesPercentage: hub.NewSummaryVec(
 			"responses_size_bytes_percentage",
 			"a summary of the total size of the returned response body from a backend",
 			httpserverLabels,
-			DefaultObjectives()).MustCurryWith(commonLabels),
+			DefaultObjectives()).MustCurryWith(sharedLabels),
+		ResponseUncompressedBytes: hub.NewHistogramVec(
+			"responses_uncompressed_size_bytes",
+			"a histogram of the total size of the returned response body before compression from a backend",
+			httpserverLabels,
+			DefaultBodySizeBuckets()).MustCurryWith(sharedLabels),
+		TTFBDuration: hub.NewHistogramVec(
+			"ttfb_duration",
+			"time to first byte histogram of the http requests in milliseconds",
+			httpserverLabels,
+			DefaultDurationBuckets()).MustCurryWith(sharedLabels),
 		M1: hub.NewGaugeVec(
 			"m1",
 			"QPS (exponentially-weighted moving average) in last 1 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M5: hub.NewGaugeVec(
 			"m5",
 			"QPS (exponentially-weighted moving average) in last 5 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M15: hub.NewGaugeVec(
 			"m15",
 			"QPS (exponentially-weighted moving average) in last 15 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M1Err: hub.NewGaugeVec(
 			"m1_err",
 			"QPS (exponentially-weighted moving average) in last 1 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M5Err: hub.NewGaugeVec(
 			"m5_err",
 			"QPS (exponentially-weighted moving average) in last 5 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M15Err: hub.NewGaugeVec(
 			"m15_err",
 			"QPS (exponentially-weighted moving average) in last 15 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M1ClientErr: hub.NewGaugeVec(
+			"m1_client_err",
+			"client error QPS (exponentially-weighted moving average) in last 1 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M5ClientErr: hub.NewGaugeVec(
+			"m5_client_err",
+			"client error QPS (exponentially-weighted moving average) in last 5 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M15ClientErr: hub.NewGaugeVec(
+			"m15_client_err",
+			"client error QPS (exponentially-weighted moving average) in last 15 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M1ServerErr: hub.NewGaugeVec(
+			"m1_server_err",
+			"server error QPS (exponentially-weighted moving average) in last 1 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M5ServerErr: hub.NewGaugeVec(
+			"m5_server_err",
+			"server error QPS (exponentially-weighted moving average) in last 5 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		M15ServerErr: hub.NewGaugeVec(
+			"m15_server_err",
+			"server error QPS (exponentially-weighted moving average) in last 15 minute",
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M1ErrPercent: hub.NewGaugeVec(
 			"m1_err_percent",
 			"error percentage in last 1 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M5ErrPercent: hub.NewGaugeVec(
 			"m5_err_percent",
 			"error percentage in last 5 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		M15ErrPercent: hub.NewGaugeVec(
 			"m15_err_percent",
 			"error percentage in last 15 minute",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		Min: hub.NewGaugeVec(
 			"min",
 			"The http-request minimal execution duration in milliseconds",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		Max: hub.NewGaugeVec(
 			"max",
 			"The http-request maximal execution duration in milliseconds",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		Mean: hub.NewGaugeVec(
 			"mean",
 			"The http-request mean execution duration in milliseconds",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TickMin: hub.NewGaugeVec(
+			"tick_min",
+			"The http-request minimal execution duration in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TickMax: hub.NewGaugeVec(
+			"tick_max",
+			"The http-request maximal execution duration in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TickMean: hub.NewGaugeVec(
+			"tick_mean",
+			"The http-request mean execution duration in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		WindowMin: hub.NewGaugeVec(
+			"window_min",
+			"The http-request minimal execution duration in milliseconds in the rolling window",
+			windowLabels).MustCurryWith(sharedLabels),
+		WindowMax: hub.NewGaugeVec(
+			"window_max",
+			"The http-request maximal execution duration in milliseconds in the rolling window",
+			windowLabels).MustCurryWith(sharedLabels),
+		WindowMean: hub.NewGaugeVec(
+			"window_mean",
+			"The http-request mean execution duration in milliseconds in the rolling window",
+			windowLabels).MustCurryWith(sharedLabels),
 		P25: hub.NewGaugeVec(
 			"p25",
 			"TP25: The processing time for 25% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P50: hub.NewGaugeVec(
 			"p50",
 			"TP50: The processing time for 50% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P75: hub.NewGaugeVec(
 			"p75",
 			"TP75: The processing time for 75% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P95: hub.NewGaugeVec(
 			"p95",
 			"TP95: The processing time for 95% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P98: hub.NewGaugeVec(
 			"p98",
 			"TP98: The processing time for 98% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P99: hub.NewGaugeVec(
 			"p99",
 			"TP99: The processing time for 99% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		P999: hub.NewGaugeVec(
 			"p999",
 			"TP999: The processing time for 99.9% of the requests, in milliseconds.",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		ReqSize: hub.NewGaugeVec(
 			"req_size",
 			"The total size of the http requests in this statistic window",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
 		RespSize: hub.NewGaugeVec(
 			"resp_size",
 			"The total size of the http responses in this statistic window",
-			httpserverLabels).MustCurryWith(commonLabels),
+			httpserverLabels).MustCurryWith(sharedLabels),
+		RespUncompressedSize: hub.NewGaugeVec(
+			"resp_uncompressed_size",
+			"The total size of the http responses before compression in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		Concurrency: hub.NewGaugeVec(
+			"concurrency",
+			"The average number of the concurrent http requests in this statistic window by Little's law",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TTFBMean: hub.NewGaugeVec(
+			"ttfb_mean",
+			"The http-request mean time to first byte in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TTFBP50: hub.NewGaugeVec(
+			"ttfb_p50",
+			"The time to first byte for 50% of the requests in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TTFBP95: hub.NewGaugeVec(
+			"ttfb_p95",
+			"The time to first byte for 95% of the requests in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
+		TTFBP99: hub.NewGaugeVec(
+			"ttfb_p99",
+			"The time to first byte for 99% of the requests in milliseconds in this statistic window",
+			httpserverLabels).MustCurryWith(sharedLabels),
 	}
-}
 
-func (m *httpRequestMetrics) exportPrometheusMetricsForTicker(status *Status, method, path string) {
-	labels := prometheus.Labels{
-		"method": method,
-		"path":   path,
+	m.OverflowRequests = hub.NewCounterVec(
+		"http_stats_overflow_requests_total",
+		"the total count of http requests collected into the overflow path because of too many routes",
+		append(slices.Clone(hubLabels), "direction")).MustCurryWith(commonLabels).WithLabelValues(direction)
+
+	if direction == DirectionClient {
+		// The metrics of the concepts of the outbound requests are prefixed with "client_".
+		targetLabels := append(slices.Clone(hubLabels), "target")
+		m.Failures = hub.NewCounterVec(
+			"client_request_failures_total",
+			"the total count of failed outbound requests by the cause, e.g. deadline_exceeded, unavailable",
+			append([]string{"method", "path", "cause"}, targetLabels...)).MustCurryWith(commonLabels)
+		m.DNSDuration = hub.NewHistogramVec(
+			"client_dns_duration",
+			"DNS lookup duration histogram of the outbound requests in milliseconds",
+			targetLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
+		m.ConnectDuration = hub.NewHistogramVec(
+			"client_connect_duration",
+			"TCP connect duration histogram of the outbound requests in milliseconds",
+			targetLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
+		m.TLSHandshakeDuration = hub.NewHistogramVec(
+			"client_tls_handshake_duration",
+			"TLS handshake duration histogram of the outbound requests in milliseconds",
+			targetLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
+		m.FirstByteDuration = hub.NewHistogramVec(
+			"client_first_byte_duration",
+			"time to first response byte histogram of the outbound requests in milliseconds",
+			targetLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
+	} else {
+		serverWindowLabels := append(slices.Clone(serverLabels), "window")
+
+		m.QueueDuration = hub.NewHistogramVec(
+			"queue_duration",
+			"queueing time histogram of the http requests before they are served in milliseconds",
+			serverLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
+		m.Apdex = hub.NewGaugeVec(
+			"apdex",
+			"The http-request Apdex score in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.WindowApdex = hub.NewGaugeVec(
+			"window_apdex",
+			"The http-request Apdex score in the rolling window",
+			serverWindowLabels).MustCurryWith(commonLabels)
+		m.InFlight = hub.NewGaugeVec(
+			"in_flight_requests",
+			"The number of the http requests being served",
+			serverLabels).MustCurryWith(commonLabels)
+		m.PeakConcurrency = hub.NewGaugeVec(
+			"peak_concurrency",
+			"The peak number of the concurrent http requests in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.Utilization = hub.NewGaugeVec(
+			"utilization",
+			"The concurrency of the http requests divided by the max concurrency of the service",
+			serverLabels).MustCurryWith(commonLabels)
+		m.QueueMean = hub.NewGaugeVec(
+			"queue_mean",
+			"The http-request mean queueing time in milliseconds in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.QueueP50 = hub.NewGaugeVec(
+			"queue_p50",
+			"The queueing time for 50% of the requests in milliseconds in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.QueueP95 = hub.NewGaugeVec(
+			"queue_p95",
+			"The queueing time for 95% of the requests in milliseconds in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.QueueP99 = hub.NewGaugeVec(
+			"queue_p99",
+			"The queueing time for 99% of the requests in milliseconds in this statistic window",
+			serverLabels).MustCurryWith(commonLabels)
+		m.Panics = hub.NewCounterVec(
+			"panics_total",
+			"the total count of http requests whose handler panicked",
+			append(slices.Clone(hubLabels), "path")).MustCurryWith(commonLabels)
+		m.ServiceInFlight = hub.NewGaugeVec(
+			"service_in_flight_requests",
+			"The number of the http requests being served by the service",
+			hubLabels).With(commonLabels)
+		m.ServicePeakConcurrency = hub.NewGaugeVec(
+			"service_peak_concurrency",
+			"The peak number of the concurrent http requests of the service in this statistic window",
+			hubLabels).With(commonLabels)
+		m.ServiceConcurrency = hub.NewGaugeVec(
+			"service_concurrency",
+			"The average number of the concurrent http requests of the service in this statistic window by Little's law",
+			hubLabels).With(commonLabels)
+		m.ServiceUtilization = hub.NewGaugeVec(
+			"service_utilization",
+			"The concurrency of the http requests of the service divided by the max concurrency of the service",
+			hubLabels).With(commonLabels)
+
+		sloLabels := append(slices.Clone(hubLabels), "slo")
+		m.SLOEvents = hub.NewCounterVec(
+			"slo_events_total",
+			"the total count of the http requests of the SLO",
+			sloLabels).MustCurryWith(commonLabels)
+		m.SLOGoodEvents = hub.NewCounterVec(
+			"slo_good_events_total",
+			"the total count of the http requests meeting the SLO",
+			sloLabels).MustCurryWith(commonLabels)
+		m.SLOObjective = hub.NewGaugeVec(
+			"slo_objective",
+			"The target ratio of the good events of the SLO",
+			sloLabels).MustCurryWith(commonLabels)
+		m.SLOErrorBudgetRemaining = hub.NewGaugeVec(
+			"slo_error_budget_remaining",
+			"The ratio of the error budget left in the period of the SLO",
+			sloLabels).MustCurryWith(commonLabels)
+		m.SLOBurnRate = hub.NewGaugeVec(
+			"slo_burn_rate",
+			"The error rate divided by the error budget rate of the SLO in the window",
+			append(slices.Clone(sloLabels), "window")).MustCurryWith(commonLabels)
+		m.SLOBurnRateAlerts = hub.NewGaugeVec(
+			"slo_burn_rate_alert",
+			"The state of the multi-window burn rate alert of the SLO, 1 if it is firing",
+			append(slices.Clone(sloLabels), "alert")).MustCurryWith(commonLabels)
+
+		connLabels := append(slices.Clone(hubLabels), "path", "kind")
+		m.ActiveConnections = hub.NewGaugeVec(
+			"active_connections",
+			"The number of the active long-lived connections, e.g. WebSocket and SSE",
+			connLabels).MustCurryWith(commonLabels)
+		m.Connections = hub.NewCounterVec(
+			"connections_total",
+			"the total count of the long-lived connections, e.g. WebSocket and SSE",
+			connLabels).MustCurryWith(commonLabels)
+		m.ConnectionDuration = hub.NewHistogramVec(
+			"connection_duration_seconds",
+			"long-lived connection duration histogram in seconds",
+			connLabels,
+			DefaultConnectionDurationBuckets()).MustCurryWith(commonLabels)
+		m.ConnectionMessagesSent = hub.NewCounterVec(
+			"connection_messages_sent_total",
+			"the total count of the messages sent by the long-lived connections",
+			connLabels).MustCurryWith(commonLabels)
+		m.ConnectionMessagesReceived = hub.NewCounterVec(
+			"connection_messages_received_total",
+			"the total count of the messages received by the long-lived connections",
+			connLabels).MustCurryWith(commonLabels)
+		m.ConnectionBytesSent = hub.NewCounterVec(
+			"connection_bytes_sent_total",
+			"the total bytes of the messages sent by the long-lived connections",
+			connLabels).MustCurryWith(commonLabels)
+		m.ConnectionBytesReceived = hub.NewCounterVec(
+			"connection_bytes_received_total",
+			"the total bytes of the messages received by the long-lived connections",
+			connLabels).MustCurryWith(commonLabels)
+
+		stateLabels := append(slices.Clone(hubLabels), "state")
+		tlsLabels := append(slices.Clone(hubLabels), "version", "protocol")
+		m.ServerConnections = hub.NewGaugeVec(
+			"server_connections",
+			"The number of the open server connections by the state, i.e. new, active and idle",
+			stateLabels).MustCurryWith(commonLabels)
+		m.ServerConnectionsTotal = hub.NewCounterVec(
+			"server_connections_total",
+			"the total count of the server connections entering the state, i.e. new, active, idle, hijacked and closed",
+			stateLabels).MustCurryWith(commonLabels)
+		m.ServerConnectionDuration = hub.NewHistogramVec(
+			"server_connection_duration_seconds",
+			"server connection lifetime histogram in seconds",
+			hubLabels,
+			DefaultConnectionDurationBuckets()).With(commonLabels)
+		m.ServerConnectionRequests = hub.NewHistogramVec(
+			"server_connection_requests",
+			"histogram of the number of the requests served by a server connection, it shows the keep-alive reuse",
+			hubLabels,
+			prometheus.ExponentialBuckets(1, 2, 10)).With(commonLabels)
+		m.AcceptErrors = hub.NewCounterVec(
+			"server_accept_errors_total",
+			"the total count of the errors accepting the server connections",
+			hubLabels).With(commonLabels)
+		m.ServerTLSHandshakes = hub.NewCounterVec(
+			"server_tls_handshakes_total",
+			"the total count of the completed TLS handshakes of the server connections",
+			tlsLabels).MustCurryWith(commonLabels)
+		m.ServerTLSHandshakeFailures = hub.NewCounterVec(
+			"server_tls_handshake_failures_total",
+			"the total count of the failed TLS handshakes of the server connections",
+			hubLabels).With(commonLabels)
+		m.ServerTLSHandshakeDuration = hub.NewHistogramVec(
+			"server_tls_handshake_duration",
+			"TLS handshake duration histogram of the server connections in milliseconds",
+			tlsLabels,
+			DefaultDurationBuckets()).MustCurryWith(commonLabels)
 	}
 
+	return m
+}
+
+func (m *httpRequestMetrics) exportPrometheusMetricsForTicker(status *Status, labels prometheus.Labels) {
+
 	m.M1.With(labels).Set(status.M1)
 	m.M5.With(labels).Set(status.M5)
 	m.M15.With(labels).Set(status.M15)
 	m.M1Err.With(labels).Set(status.M1Err)
 	m.M5Err.With(labels).Set(status.M5Err)
 	m.M15Err.With(labels).Set(status.M15Err)
+	m.M1ClientErr.With(labels).Set(status.M1ClientErr)
+	m.M5ClientErr.With(labels).Set(status.M5ClientErr)
+	m.M15ClientErr.With(labels).Set(status.M15ClientErr)
+	m.M1ServerErr.With(labels).Set(status.M1ServerErr)
+	m.M5ServerErr.With(labels).Set(status.M5ServerErr)
+	m.M15ServerErr.With(labels).Set(status.M15ServerErr)
 	m.M1ErrPercent.With(labels).Set(status.M1ErrPercent)
 	m.M5ErrPercent.With(labels).Set(status.M5ErrPercent)
 	m.M15ErrPercent.With(labels).Set(status.M15ErrPercent)
 	m.Min.With(labels).Set(float64(status.Min))
 	m.Max.With(labels).Set(float64(status.Max))
 	m.Mean.With(labels).Set(float64(status.Mean))
+	m.TickMin.With(labels).Set(float64(status.TickMin))
+	m.TickMax.With(labels).Set(float64(status.TickMax))
+	m.TickMean.With(labels).Set(float64(status.TickMean))
+	for _, w := range status.Windows {
+		windowLabels := maps.Clone(labels)
+		windowLabels["window"] = w.Window
+		m.WindowMin.With(windowLabels).Set(float64(w.Min))
+		m.WindowMax.With(windowLabels).Set(float64(w.Max))
+		m.WindowMean.With(windowLabels).Set(float64(w.Mean))
+		if m.WindowApdex != nil {
+			m.WindowApdex.With(windowLabels).Set(w.Apdex)
+		}
+	}
 	m.P25.With(labels).Set(status.P25)
 	m.P50.With(labels).Set(status.P50)
 	m.P75.With(labels).Set(status.P75)
@@ -226,18 +605,56 @@ func (m *httpRequestMetrics) exportPrometheusMetricsForTicker(status *Status, me
 	m.P999.With(labels).Set(status.P999)
 	m.ReqSize.With(labels).Set(float64(status.ReqSize))
 	m.RespSize.With(labels).Set(float64(status.RespSize))
-}
+	m.RespUncompressedSize.With(labels).Set(float64(status.RespUncompressedSize))
+	m.Concurrency.With(labels).Set(status.Concurrency)
+	m.TTFBMean.With(labels).Set(float64(status.TTFBMean))
+	m.TTFBP50.With(labels).Set(status.TTFBP50)
+	m.TTFBP95.With(labels).Set(status.TTFBP95)
+	m.TTFBP99.With(labels).Set(status.TTFBP99)
 
-func (m *httpRequestMetrics) exportPrometheusMetricsForRequestMetric(stat *RequestMetric, method, path string) {
-	labels := prometheus.Labels{
-		"method": method,
-		"path":   path,
+	// The metrics of the concepts of the server are nil for the client direction.
+	if m.Apdex == nil {
+		return
 	}
+	m.Apdex.With(labels).Set(status.Apdex)
+	m.PeakConcurrency.With(labels).Set(float64(status.PeakConcurrency))
+	m.Utilization.With(labels).Set(status.Utilization)
+	m.QueueMean.With(labels).Set(float64(status.QueueMean))
+	m.QueueP50.With(labels).Set(status.QueueP50)
+	m.QueueP95.With(labels).Set(status.QueueP95)
+	m.QueueP99.With(labels).Set(status.QueueP99)
+}
+
+func (m *httpRequestMetrics) exportPrometheusMetricsForRequestMetric(stat *RequestMetric, labels prometheus.Labels) {
 
 	m.TotalRequests.With(labels).Inc()
 	m.TotalResponses.With(labels).Inc()
-	if stat.StatusCode >= 400 {
+	switch stat.errorClass() {
+	case ErrorClassClient:
+		m.TotalErrorRequests.With(labels).Inc()
+		m.TotalClientErrorRequests.With(labels).Inc()
+	case ErrorClassServer:
 		m.TotalErrorRequests.With(labels).Inc()
+		m.TotalServerErrorRequests.With(labels).Inc()
+	}
+	class := statusClass(stat.StatusCode)
+	code := class
+	if !m.collapseStatusCodes {
+		code = strconv.Itoa(stat.StatusCode)
+	}
+	codeLabels := maps.Clone(labels)
+	codeLabels["code"] = code
+	codeLabels["class"] = class
+	if stat.StatusCode != 0 {
+		m.TotalResponsesByCode.With(codeLabels).Inc()
+	}
+	if m.Panics != nil && stat.Panicked {
+		m.Panics.With(prometheus.Labels{"path": labels["path"]}).Inc()
+	}
+	if m.Failures != nil && stat.Cause != "" {
+		failureLabels := maps.Clone(labels)
+		failureLabels["cause"] = stat.Cause
+		m.Failures.With(failureLabels).Inc()
 	}
 	m.RequestsDuration.With(labels).Observe(float64(stat.Duration.Milliseconds()))
 	m.RequestSizeBytes.With(labels).Observe(float64(stat.ReqSize))
@@ -245,4 +662,35 @@ func (m *httpRequestMetrics) exportPrometheusMetricsForRequestMetric(stat *Reque
 	m.RequestsDurationPercentage.With(labels).Observe(float64(stat.Duration.Milliseconds()))
 	m.RequestSizeBytesPercentage.With(labels).Observe(float64(stat.ReqSize))
 	m.ResponseSizeBytesPercentage.With(labels).Observe(float64(stat.RespSize))
+	m.ResponseUncompressedBytes.With(labels).Observe(float64(stat.uncompressedSize()))
+	if stat.TTFB > 0 {
+		m.TTFBDuration.With(labels).Observe(float64(stat.TTFB.Milliseconds()))
+	}
+	if m.QueueDuration != nil && stat.QueueTime > 0 {
+		m.QueueDuration.With(labels).Observe(float64(stat.QueueTime.Milliseconds()))
+	}
+}
+
+// statusClass returns the class of the status code, e.g. 2xx, 5xx.
+func statusClass(code int) string {
+	if code < 100 || code >= 600 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// labels returns the variable labels of the http metrics of the key, the extra
+// labels are decoded from the key by extraLabels.
+func (key httpStatsKey) labels(extraLabels map[string]string) prometheus.Labels {
+	labels := prometheus.Labels{
+		"method": key.Method,
+		"path":   key.Path,
+	}
+	if key.Direction == DirectionClient {
+		labels["target"] = key.Target
+	}
+	for k, v := range extraLabels {
+		labels[k] = v
+	}
+	return labels
 }
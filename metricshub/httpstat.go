@@ -1,7 +1,9 @@
 package metricshub
 
 import (
+	"fmt"
 	"math"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,11 @@ type (
 	HTTPStat struct {
 		mutex sync.RWMutex
 
+		// labels are the variable labels of the metrics of the route, and extraLabels
+		// are the extra labels of the route, they are decoded once from the key.
+		labels      map[string]string
+		extraLabels map[string]string
+
 		count  uint64
 		rate1  metrics.EWMA
 		rate5  metrics.EWMA
@@ -26,26 +33,139 @@ type (
 		errRate5  metrics.EWMA
 		errRate15 metrics.EWMA
 
+		clientErrCount  uint64
+		clientErrRate1  metrics.EWMA
+		clientErrRate5  metrics.EWMA
+		clientErrRate15 metrics.EWMA
+
+		serverErrCount  uint64
+		serverErrRate1  metrics.EWMA
+		serverErrRate5  metrics.EWMA
+		serverErrRate15 metrics.EWMA
+
 		total uint64
 		min   uint64
 		max   uint64
 
+		// tick* are the duration statistics of the current tick,
+		// they are reset every time Status is called.
+		tickCount uint64
+		tickTotal uint64
+		tickMin   uint64
+		tickMax   uint64
+
+		// inFlight is the number of the requests being served, tickPeak is
+		// the peak of inFlight in the current tick.
+		inFlight uint64
+		tickPeak uint64
+
+		// windows are the rolling windows for the duration statistics,
+		// slots is a ring buffer of the recent ticks, slotIdx points to
+		// the next slot to write.
+		windows []time.Duration
+		slots   []latencySlot
+		slotIdx int
+
 		durationSampler *helper.DurationSampler
 
+		// tickTTFB* and tickQueue* are the time to first byte and queueing time
+		// statistics of the current tick, only the known values are counted.
+		tickTTFBCount  uint64
+		tickTTFBTotal  uint64
+		ttfbSampler    *helper.DurationSampler
+		tickQueueCount uint64
+		tickQueueTotal uint64
+		queueSampler   *helper.DurationSampler
+
+		// apdexTarget is the Apdex target T, tickSatisfied, tickTolerating and
+		// tickFrustrated are the Apdex counts of the current tick.
+		apdexTarget    time.Duration
+		tickSatisfied  uint64
+		tickTolerating uint64
+		tickFrustrated uint64
+
 		reqSize  uint64
 		respSize uint64
+		// respUncompressedSize is the size of the responses before compression.
+		respUncompressedSize uint64
 
 		cc *helper.HTTPStatusCodeCounter
 	}
 
+	// latencySlot is the duration statistics of a tick.
+	latencySlot struct {
+		count uint64
+		total uint64
+		min   uint64
+		max   uint64
+
+		satisfied  uint64
+		tolerating uint64
+		frustrated uint64
+	}
+
 	// RequestMetric is the package of statistics at once.
 	RequestMetric struct {
 		StatusCode int
 		Duration   time.Duration
 		ReqSize    uint64
 		RespSize   uint64
+
+		// RespUncompressedSize is the size of the response body before it is compressed,
+		// e.g. by a gzip middleware, RespSize is the size on the wire.
+		// Zero means the response is not compressed or the size is unknown, e.g. it is
+		// not collected by the net/http, chi and gorilla/mux middlewares.
+		// +optional
+		RespUncompressedSize uint64
+
+		// Err is the error returned by the handler, if any.
+		// It is only used for error classification.
+		// +optional
+		Err error
+		// Header is the response header.
+		// It is only used for error classification.
+		// +optional
+		Header http.Header
+		// Cause is the cause of the failed outbound request, e.g. CauseDeadlineExceeded.
+		// It is only used by the client direction, see MetricsHub.UpdateClientRequestMetrics.
+		// +optional
+		Cause string
+		// TTFB is the time to first byte, from the start of the request to the time
+		// the response header or the first byte of the body is written.
+		// Zero means it is unknown.
+		// +optional
+		TTFB time.Duration
+		// QueueTime is the time the request waits before it is served, e.g. in the
+		// queue of the load balancer, derived from the X-Request-Start header.
+		// Zero means it is unknown.
+		// +optional
+		QueueTime time.Duration
+		// RawPath is the raw URL path of the request.
+		// It is only used by the sample capture, see MetricsHubConfig.SampleCapture.
+		// +optional
+		RawPath string
+		// TraceID is the trace ID of the request, e.g. from the traceparent header.
+		// It is only used by the sample capture, see MetricsHubConfig.SampleCapture.
+		// +optional
+		TraceID string
+		// Labels is the values of the extra labels declared by MetricsHubConfig.HTTPExtraLabels,
+		// the undeclared keys and the labels of the outbound requests are ignored.
+		// +optional
+		Labels map[string]string
+		// Panicked is true if the handler panicked, it is counted by panics_total.
+		// +optional
+		Panicked bool
+
+		errClass   ErrorClass
+		classified bool
 	}
 
+	// ErrorClass is the error class of a request.
+	ErrorClass int
+
+	// ErrorClassifier classifies a request into an error class.
+	ErrorClassifier func(m *RequestMetric) ErrorClass
+
 	// StatisticsMetric contains request metrics.
 	StatisticsMetric struct {
 		Count uint64  `json:"count"`
@@ -58,14 +178,30 @@ type (
 		M5Err    float64 `json:"m5Err"`
 		M15Err   float64 `json:"m15Err"`
 
+		ClientErrCount uint64  `json:"clientErrCount"`
+		M1ClientErr    float64 `json:"m1ClientErr"`
+		M5ClientErr    float64 `json:"m5ClientErr"`
+		M15ClientErr   float64 `json:"m15ClientErr"`
+
+		ServerErrCount uint64  `json:"serverErrCount"`
+		M1ServerErr    float64 `json:"m1ServerErr"`
+		M5ServerErr    float64 `json:"m5ServerErr"`
+		M15ServerErr   float64 `json:"m15ServerErr"`
+
 		M1ErrPercent  float64 `json:"m1ErrPercent"`
 		M5ErrPercent  float64 `json:"m5ErrPercent"`
 		M15ErrPercent float64 `json:"m15ErrPercent"`
 
+		// Min, Max and Mean are accumulated since the HTTPStat is created.
 		Min  uint64 `json:"min"`
 		Max  uint64 `json:"max"`
 		Mean uint64 `json:"mean"`
 
+		// TickMin, TickMax and TickMean are in the current statistic window.
+		TickMin  uint64 `json:"tickMin"`
+		TickMax  uint64 `json:"tickMax"`
+		TickMean uint64 `json:"tickMean"`
+
 		P25  float64 `json:"p25"`
 		P50  float64 `json:"p50"`
 		P75  float64 `json:"p75"`
@@ -76,6 +212,43 @@ type (
 
 		ReqSize  uint64 `json:"reqSize"`
 		RespSize uint64 `json:"respSize"`
+		// RespUncompressedSize is the total size of the responses before compression,
+		// the size of the uncompressed responses is the same as RespSize.
+		RespUncompressedSize uint64 `json:"respUncompressedSize"`
+
+		// InFlight is the number of the requests being served, PeakConcurrency is
+		// the peak of InFlight in the current statistic window. They only count the
+		// requests whose route is known before they are served, see MetricsHub.TrackHTTPRequest.
+		InFlight        uint64 `json:"inFlight"`
+		PeakConcurrency uint64 `json:"peakConcurrency"`
+		// Concurrency is the average number of the concurrent requests in the current
+		// statistic window derived by Little's law, i.e. arrival rate * mean duration.
+		Concurrency float64 `json:"concurrency"`
+		// Utilization is Concurrency divided by MetricsHubConfig.MaxConcurrency,
+		// it is 0 if MaxConcurrency is not set or for the client direction.
+		Utilization float64 `json:"utilization"`
+
+		// TTFBMean and TTFBP* are the time to first byte in milliseconds in the
+		// current statistic window, see RequestMetric.TTFB.
+		TTFBMean uint64  `json:"ttfbMean"`
+		TTFBP50  float64 `json:"ttfbP50"`
+		TTFBP95  float64 `json:"ttfbP95"`
+		TTFBP99  float64 `json:"ttfbP99"`
+		// QueueMean and QueueP* are the queueing time in milliseconds in the
+		// current statistic window, see RequestMetric.QueueTime.
+		QueueMean uint64  `json:"queueMean"`
+		QueueP50  float64 `json:"queueP50"`
+		QueueP95  float64 `json:"queueP95"`
+		QueueP99  float64 `json:"queueP99"`
+
+		// ApdexTarget is the Apdex target T in milliseconds, Apdex is the score
+		// (satisfied + tolerating / 2) / count in the current statistic window,
+		// it is 1 if there is no request.
+		ApdexTarget     uint64  `json:"apdexTarget"`
+		Apdex           float64 `json:"apdex"`
+		ApdexSatisfied  uint64  `json:"apdexSatisfied"`
+		ApdexTolerating uint64  `json:"apdexTolerating"`
+		ApdexFrustrated uint64  `json:"apdexFrustrated"`
 	}
 
 	// StatusCodeMetric is the metrics of http status code.
@@ -84,19 +257,120 @@ type (
 		Count uint64 `json:"cnt"`
 	}
 
+	// WindowMetric contains the duration metrics in a rolling window.
+	WindowMetric struct {
+		Window string `json:"window"`
+		Count  uint64 `json:"count"`
+		Min    uint64 `json:"min"`
+		Max    uint64 `json:"max"`
+		Mean   uint64 `json:"mean"`
+		// Apdex is the Apdex score in the window, see StatisticsMetric.Apdex.
+		Apdex float64 `json:"apdex"`
+	}
+
 	// Status contains all status generated by HTTPStat.
 	Status struct {
 		StatisticsMetric
-		Codes map[int]uint64 `json:"codes"`
+		Codes   map[int]uint64 `json:"codes"`
+		Windows []WindowMetric `json:"windows"`
+	}
+)
+
+// The error classes of a request.
+const (
+	// ErrorClassNone means the request is not an error.
+	ErrorClassNone ErrorClass = iota
+	// ErrorClassClient means the request is failed because of the client, e.g. 4xx.
+	ErrorClassClient
+	// ErrorClassServer means the request is failed because of the server, e.g. 5xx.
+	ErrorClassServer
+)
+
+// uncompressedSize returns the size of the response body before compression.
+func (m *RequestMetric) uncompressedSize() uint64 {
+	if m.RespUncompressedSize > 0 {
+		return m.RespUncompressedSize
 	}
+	return m.RespSize
+}
+
+// The causes of the failed outbound requests.
+const (
+	// CauseDeadlineExceeded means the request is failed because of the deadline or timeout.
+	CauseDeadlineExceeded = "deadline_exceeded"
+	// CauseUnavailable means the request is failed because the target is unavailable.
+	CauseUnavailable = "unavailable"
+	// CauseCanceled means the request is canceled by the caller.
+	CauseCanceled = "canceled"
+	// CauseDNS means the request is failed to resolve the host.
+	CauseDNS = "dns"
+	// CauseConnectionRefused means the connection is refused by the target.
+	CauseConnectionRefused = "connection_refused"
+	// CauseConnectionReset means the connection is reset by the target.
+	CauseConnectionReset = "connection_reset"
+	// CauseTLS means the request is failed in the TLS handshake.
+	CauseTLS = "tls"
+	// CauseTransport means the request is failed because of the other transport errors.
+	CauseTransport = "transport"
 )
 
+// DefaultErrorClassifier treats 4xx as client errors and 5xx as server errors.
+// The outbound requests canceled by the caller are client errors, and those
+// failed by the other causes, e.g. the transport failures, are server errors.
+func DefaultErrorClassifier(m *RequestMetric) ErrorClass {
+	switch {
+	case m.Cause == CauseCanceled:
+		return ErrorClassClient
+	case m.Cause != "":
+		return ErrorClassServer
+	case m.StatusCode >= 500:
+		return ErrorClassServer
+	case m.StatusCode >= 400:
+		return ErrorClassClient
+	default:
+		return ErrorClassNone
+	}
+}
+
+// classify classifies the request with the classifier, the result will be
+// used by all the statistics of the request.
+func (m *RequestMetric) classify(classifier ErrorClassifier) {
+	if classifier == nil {
+		classifier = DefaultErrorClassifier
+	}
+	m.errClass = classifier(m)
+	m.classified = true
+}
+
+func (m *RequestMetric) errorClass() ErrorClass {
+	if !m.classified {
+		m.classify(nil)
+	}
+	return m.errClass
+}
+
 func (m *RequestMetric) isErr() bool {
-	return m.StatusCode >= 400
+	return m.errorClass() != ErrorClassNone
 }
 
-// NewHTTPStat creates an HTTPStat.
+// DefaultLatencyWindows returns the default rolling windows of the duration statistics.
+func DefaultLatencyWindows() []time.Duration {
+	return []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+}
+
+// NewHTTPStat creates an HTTPStat with the default latency windows.
 func NewHTTPStat() *HTTPStat {
+	return NewHTTPStatWithWindows(DefaultLatencyWindows())
+}
+
+// NewHTTPStatWithWindows creates an HTTPStat with the given latency windows.
+// The windows are rounded up to the multiple of the update interval (5s).
+func NewHTTPStatWithWindows(windows []time.Duration) *HTTPStat {
+	maxSlots := 0
+	for _, w := range windows {
+		maxSlots = max(maxSlots, windowSlots(w))
+	}
+
 	hs := &HTTPStat{
 		rate1:  metrics.NewEWMA1(),
 		rate5:  metrics.NewEWMA5(),
@@ -106,8 +380,22 @@ func NewHTTPStat() *HTTPStat {
 		errRate5:  metrics.NewEWMA5(),
 		errRate15: metrics.NewEWMA15(),
 
+		clientErrRate1:  metrics.NewEWMA1(),
+		clientErrRate5:  metrics.NewEWMA5(),
+		clientErrRate15: metrics.NewEWMA15(),
+
+		serverErrRate1:  metrics.NewEWMA1(),
+		serverErrRate5:  metrics.NewEWMA5(),
+		serverErrRate15: metrics.NewEWMA15(),
+
 		min:             math.MaxUint64,
+		tickMin:         math.MaxUint64,
+		windows:         windows,
+		slots:           make([]latencySlot, maxSlots),
 		durationSampler: helper.NewDurationSampler(),
+		ttfbSampler:     helper.NewDurationSampler(),
+		queueSampler:    helper.NewDurationSampler(),
+		apdexTarget:     DefaultApdexTarget,
 
 		cc: helper.New(),
 	}
@@ -137,33 +425,72 @@ func (hs *HTTPStat) Stat(m *RequestMetric) {
 		hs.errRate15.Update(1)
 	}
 
+	switch m.errorClass() {
+	case ErrorClassClient:
+		atomic.AddUint64(&hs.clientErrCount, 1)
+		hs.clientErrRate1.Update(1)
+		hs.clientErrRate5.Update(1)
+		hs.clientErrRate15.Update(1)
+	case ErrorClassServer:
+		atomic.AddUint64(&hs.serverErrCount, 1)
+		hs.serverErrRate1.Update(1)
+		hs.serverErrRate5.Update(1)
+		hs.serverErrRate15.Update(1)
+	}
+
 	duration := uint64(m.Duration.Milliseconds())
 	atomic.AddUint64(&hs.total, duration)
-	for {
-		minN := atomic.LoadUint64(&hs.min)
-		if duration >= minN {
-			break
-		}
-		if atomic.CompareAndSwapUint64(&hs.min, minN, duration) {
-			break
-		}
-	}
-	for {
-		maxN := atomic.LoadUint64(&hs.max)
-		if duration <= maxN {
-			break
-		}
-		if atomic.CompareAndSwapUint64(&hs.max, maxN, duration) {
-			break
-		}
-	}
+	updateMin(&hs.min, duration)
+	updateMax(&hs.max, duration)
+
+	atomic.AddUint64(&hs.tickCount, 1)
+	atomic.AddUint64(&hs.tickTotal, duration)
+	updateMin(&hs.tickMin, duration)
+	updateMax(&hs.tickMax, duration)
 
 	hs.durationSampler.Update(m.Duration)
 
+	switch {
+	case m.isErr() || m.Duration > 4*hs.apdexTarget:
+		atomic.AddUint64(&hs.tickFrustrated, 1)
+	case m.Duration > hs.apdexTarget:
+		atomic.AddUint64(&hs.tickTolerating, 1)
+	default:
+		atomic.AddUint64(&hs.tickSatisfied, 1)
+	}
+
+	if m.TTFB > 0 {
+		atomic.AddUint64(&hs.tickTTFBCount, 1)
+		atomic.AddUint64(&hs.tickTTFBTotal, uint64(m.TTFB.Milliseconds()))
+		hs.ttfbSampler.Update(m.TTFB)
+	}
+	if m.QueueTime > 0 {
+		atomic.AddUint64(&hs.tickQueueCount, 1)
+		atomic.AddUint64(&hs.tickQueueTotal, uint64(m.QueueTime.Milliseconds()))
+		hs.queueSampler.Update(m.QueueTime)
+	}
+
 	atomic.AddUint64(&hs.reqSize, m.ReqSize)
 	atomic.AddUint64(&hs.respSize, m.RespSize)
+	atomic.AddUint64(&hs.respUncompressedSize, m.uncompressedSize())
+
+	// the failed outbound requests have no status code.
+	if m.StatusCode != 0 {
+		hs.cc.Count(m.StatusCode)
+	}
+}
+
+// Begin marks a request is being served, End must be called when it is finished.
+func (hs *HTTPStat) Begin() {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	updateMax(&hs.tickPeak, atomic.AddUint64(&hs.inFlight, 1))
+}
 
-	hs.cc.Count(m.StatusCode)
+// End marks a request marked by Begin is finished.
+func (hs *HTTPStat) End() {
+	atomic.AddUint64(&hs.inFlight, ^uint64(0))
 }
 
 // Status returns HTTPStat Status, It assumes it is called every five seconds.
@@ -178,6 +505,12 @@ func (hs *HTTPStat) Status() *Status {
 	hs.errRate1.Tick()
 	hs.errRate5.Tick()
 	hs.errRate15.Tick()
+	hs.clientErrRate1.Tick()
+	hs.clientErrRate5.Tick()
+	hs.clientErrRate15.Tick()
+	hs.serverErrRate1.Tick()
+	hs.serverErrRate5.Tick()
+	hs.serverErrRate15.Tick()
 
 	m1, m5, m15 := hs.rate1.Rate(), hs.rate5.Rate(), hs.rate15.Rate()
 	m1Err, m5Err, m15Err := hs.errRate1.Rate(), hs.errRate5.Rate(), hs.errRate15.Rate()
@@ -186,15 +519,40 @@ func (hs *HTTPStat) Status() *Status {
 		m1ErrPercent = m1Err / m1
 	}
 	if m5 > 0 {
-		m1ErrPercent = m5Err / m5
+		m5ErrPercent = m5Err / m5
 	}
 	if m15 > 0 {
-		m1ErrPercent = m15Err / m15
+		m15ErrPercent = m15Err / m15
+	}
+
+	tick := latencySlot{
+		count: hs.tickCount,
+		total: hs.tickTotal,
+		min:   hs.tickMin,
+		max:   hs.tickMax,
+
+		satisfied:  hs.tickSatisfied,
+		tolerating: hs.tickTolerating,
+		frustrated: hs.tickFrustrated,
 	}
+	hs.tickCount, hs.tickTotal, hs.tickMin, hs.tickMax = 0, 0, math.MaxUint64, 0
+	hs.tickSatisfied, hs.tickTolerating, hs.tickFrustrated = 0, 0, 0
+	inFlight := atomic.LoadUint64(&hs.inFlight)
+	peak := max(hs.tickPeak, inFlight)
+	hs.tickPeak = inFlight
+	windows := hs.updateWindows(tick)
 
 	percentiles := hs.durationSampler.Percentiles()
 	hs.durationSampler.Reset()
 
+	ttfb := latencySlot{count: hs.tickTTFBCount, total: hs.tickTTFBTotal}
+	ttfbPercentiles := hs.ttfbSampler.Percentiles()
+	queue := latencySlot{count: hs.tickQueueCount, total: hs.tickQueueTotal}
+	queuePercentiles := hs.queueSampler.Percentiles()
+	hs.tickTTFBCount, hs.tickTTFBTotal, hs.tickQueueCount, hs.tickQueueTotal = 0, 0, 0, 0
+	hs.ttfbSampler.Reset()
+	hs.queueSampler.Reset()
+
 	codes := hs.cc.Codes()
 	hs.cc.Reset()
 
@@ -215,6 +573,16 @@ func (hs *HTTPStat) Status() *Status {
 			M5Err:    m5Err,
 			M15Err:   m15Err,
 
+			ClientErrCount: hs.clientErrCount,
+			M1ClientErr:    hs.clientErrRate1.Rate(),
+			M5ClientErr:    hs.clientErrRate5.Rate(),
+			M15ClientErr:   hs.clientErrRate15.Rate(),
+
+			ServerErrCount: hs.serverErrCount,
+			M1ServerErr:    hs.serverErrRate1.Rate(),
+			M5ServerErr:    hs.serverErrRate5.Rate(),
+			M15ServerErr:   hs.serverErrRate15.Rate(),
+
 			M1ErrPercent:  m1ErrPercent,
 			M5ErrPercent:  m5ErrPercent,
 			M15ErrPercent: m15ErrPercent,
@@ -223,6 +591,10 @@ func (hs *HTTPStat) Status() *Status {
 			Mean: mean,
 			Max:  hs.max,
 
+			TickMin:  tick.minValue(),
+			TickMax:  tick.max,
+			TickMean: tick.mean(),
+
 			P25:  percentiles[0],
 			P50:  percentiles[1],
 			P75:  percentiles[2],
@@ -233,10 +605,140 @@ func (hs *HTTPStat) Status() *Status {
 
 			ReqSize:  hs.reqSize,
 			RespSize: hs.respSize,
+
+			RespUncompressedSize: hs.respUncompressedSize,
+
+			InFlight:        inFlight,
+			PeakConcurrency: peak,
+			Concurrency:     float64(tick.total) / float64(httpStatusUpdateInterval.Milliseconds()),
+
+			TTFBMean: ttfb.mean(),
+			TTFBP50:  ttfbPercentiles[1],
+			TTFBP95:  ttfbPercentiles[3],
+			TTFBP99:  ttfbPercentiles[5],
+
+			QueueMean: queue.mean(),
+			QueueP50:  queuePercentiles[1],
+			QueueP95:  queuePercentiles[3],
+			QueueP99:  queuePercentiles[5],
+
+			ApdexTarget:     uint64(hs.apdexTarget.Milliseconds()),
+			Apdex:           tick.apdex(),
+			ApdexSatisfied:  tick.satisfied,
+			ApdexTolerating: tick.tolerating,
+			ApdexFrustrated: tick.frustrated,
 		},
 
-		Codes: codes,
+		Codes:   codes,
+		Windows: windows,
 	}
 
 	return status
 }
+
+// updateWindows pushes the statistics of the last tick into the ring buffer,
+// and returns the metrics of all windows.
+func (hs *HTTPStat) updateWindows(tick latencySlot) []WindowMetric {
+	if len(hs.slots) == 0 {
+		return nil
+	}
+
+	hs.slots[hs.slotIdx] = tick
+	hs.slotIdx = (hs.slotIdx + 1) % len(hs.slots)
+
+	result := make([]WindowMetric, 0, len(hs.windows))
+	for _, w := range hs.windows {
+		agg := latencySlot{min: math.MaxUint64}
+		n := windowSlots(w)
+		for i := 1; i <= n; i++ {
+			slot := hs.slots[(hs.slotIdx-i+len(hs.slots))%len(hs.slots)]
+			if slot.count == 0 {
+				continue
+			}
+			agg.count += slot.count
+			agg.total += slot.total
+			agg.min = min(agg.min, slot.min)
+			agg.max = max(agg.max, slot.max)
+			agg.satisfied += slot.satisfied
+			agg.tolerating += slot.tolerating
+			agg.frustrated += slot.frustrated
+		}
+		result = append(result, WindowMetric{
+			Window: FormatWindow(w),
+			Count:  agg.count,
+			Min:    agg.minValue(),
+			Max:    agg.max,
+			Mean:   agg.mean(),
+			Apdex:  agg.apdex(),
+		})
+	}
+
+	return result
+}
+
+func (s *latencySlot) minValue() uint64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.min
+}
+
+func (s *latencySlot) mean() uint64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / s.count
+}
+
+// apdex returns the Apdex score of the slot, it is 1 if there is no request.
+func (s *latencySlot) apdex() float64 {
+	n := s.satisfied + s.tolerating + s.frustrated
+	if n == 0 {
+		return 1
+	}
+	return (float64(s.satisfied) + float64(s.tolerating)/2) / float64(n)
+}
+
+// windowSlots returns the number of ticks in the window.
+func windowSlots(w time.Duration) int {
+	n := int((w + httpStatusUpdateInterval - 1) / httpStatusUpdateInterval)
+	return max(n, 1)
+}
+
+// FormatWindow formats the window as a short label value, e.g. 1m, 15m, 1h.
+func FormatWindow(w time.Duration) string {
+	switch {
+	case w%time.Hour == 0:
+		return fmt.Sprintf("%dh", w/time.Hour)
+	case w%time.Minute == 0:
+		return fmt.Sprintf("%dm", w/time.Minute)
+	case w%time.Second == 0:
+		return fmt.Sprintf("%ds", w/time.Second)
+	default:
+		return w.String()
+	}
+}
+
+func updateMin(addr *uint64, v uint64) {
+	for {
+		minN := atomic.LoadUint64(addr)
+		if v >= minN {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, minN, v) {
+			return
+		}
+	}
+}
+
+func updateMax(addr *uint64, v uint64) {
+	for {
+		maxN := atomic.LoadUint64(addr)
+		if v <= maxN {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, maxN, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metricshub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStatWindows(t *testing.T) {
+	hs := NewHTTPStatWithWindows([]time.Duration{10 * time.Second, time.Minute})
+
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 100 * time.Millisecond})
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 300 * time.Millisecond})
+	status := hs.Status()
+	assert.Equal(t, uint64(100), status.TickMin)
+	assert.Equal(t, uint64(300), status.TickMax)
+	assert.Equal(t, uint64(200), status.TickMean)
+	assert.Equal(t, []WindowMetric{
+		{Window: "10s", Count: 2, Min: 100, Max: 300, Mean: 200, Apdex: 1},
+		{Window: "1m", Count: 2, Min: 100, Max: 300, Mean: 200, Apdex: 1},
+	}, status.Windows)
+
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 50 * time.Millisecond})
+	status = hs.Status()
+	assert.Equal(t, uint64(50), status.TickMin)
+	assert.Equal(t, uint64(50), status.TickMax)
+	assert.Equal(t, WindowMetric{Window: "10s", Count: 3, Min: 50, Max: 300, Mean: 150, Apdex: 1}, status.Windows[0])
+
+	// the 10s window only covers the last two ticks.
+	status = hs.Status()
+	assert.Equal(t, uint64(0), status.TickMin)
+	assert.Equal(t, uint64(0), status.TickMean)
+	assert.Equal(t, WindowMetric{Window: "10s", Count: 1, Min: 50, Max: 50, Mean: 50, Apdex: 1}, status.Windows[0])
+	assert.Equal(t, WindowMetric{Window: "1m", Count: 3, Min: 50, Max: 300, Mean: 150, Apdex: 1}, status.Windows[1])
+
+	// lifetime values are kept.
+	assert.Equal(t, uint64(50), status.Min)
+	assert.Equal(t, uint64(300), status.Max)
+	assert.Equal(t, uint64(150), status.Mean)
+}
+
+func TestFormatWindow(t *testing.T) {
+	assert.Equal(t, "30s", FormatWindow(30*time.Second))
+	assert.Equal(t, "5m", FormatWindow(5*time.Minute))
+	assert.Equal(t, "6h", FormatWindow(6*time.Hour))
+	assert.Equal(t, "1.5s", FormatWindow(1500*time.Millisecond))
+}
+
+func TestHTTPStatErrorClassifier(t *testing.T) {
+	hs := NewHTTPStat()
+
+	hs.Stat(&RequestMetric{StatusCode: 200})
+	hs.Stat(&RequestMetric{StatusCode: 404})
+	hs.Stat(&RequestMetric{StatusCode: 503})
+
+	// 404 is not an error for lookup APIs.
+	m := &RequestMetric{StatusCode: 404}
+	m.classify(func(m *RequestMetric) ErrorClass {
+		if m.StatusCode == 404 {
+			return ErrorClassNone
+		}
+		return DefaultErrorClassifier(m)
+	})
+	hs.Stat(m)
+
+	status := hs.Status()
+	assert.Equal(t, uint64(4), status.Count)
+	assert.Equal(t, uint64(2), status.ErrCount)
+	assert.Equal(t, uint64(1), status.ClientErrCount)
+	assert.Equal(t, uint64(1), status.ServerErrCount)
+	assert.InDelta(t, 0.5, status.M1ErrPercent, 0.001)
+	assert.InDelta(t, 0.5, status.M5ErrPercent, 0.001)
+	assert.InDelta(t, 0.5, status.M15ErrPercent, 0.001)
+}
+
+func TestHTTPStatTTFBAndQueueTime(t *testing.T) {
+	hs := NewHTTPStat()
+
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: time.Second, TTFB: 100 * time.Millisecond, QueueTime: 20 * time.Millisecond})
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: time.Second, TTFB: 300 * time.Millisecond})
+	status := hs.Status()
+	assert.Equal(t, uint64(200), status.TTFBMean)
+	assert.Equal(t, float64(100), status.TTFBP50)
+	assert.Equal(t, float64(300), status.TTFBP99)
+	assert.Equal(t, uint64(20), status.QueueMean)
+	assert.Equal(t, float64(20), status.QueueP99)
+
+	// they are reset every tick.
+	status = hs.Status()
+	assert.Equal(t, uint64(0), status.TTFBMean)
+	assert.Equal(t, float64(0), status.QueueP99)
+}
+
+func TestHTTPStatApdex(t *testing.T) {
+	hs := NewHTTPStatWithWindows([]time.Duration{10 * time.Second})
+	hs.apdexTarget = 100 * time.Millisecond
+
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 100 * time.Millisecond})
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 50 * time.Millisecond})
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 400 * time.Millisecond})
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 401 * time.Millisecond})
+	// the errors are frustrated regardless of the duration.
+	hs.Stat(&RequestMetric{StatusCode: 500, Duration: 10 * time.Millisecond})
+	status := hs.Status()
+	assert.Equal(t, uint64(100), status.ApdexTarget)
+	assert.Equal(t, uint64(2), status.ApdexSatisfied)
+	assert.Equal(t, uint64(1), status.ApdexTolerating)
+	assert.Equal(t, uint64(2), status.ApdexFrustrated)
+	assert.InDelta(t, 0.5, status.Apdex, 1e-9)
+	assert.InDelta(t, 0.5, status.Windows[0].Apdex, 1e-9)
+
+	hs.Stat(&RequestMetric{StatusCode: 200, Duration: 10 * time.Millisecond})
+	status = hs.Status()
+	assert.Equal(t, float64(1), status.Apdex)
+	assert.InDelta(t, 3.5/6, status.Windows[0].Apdex, 1e-9)
+
+	// no request in the tick.
+	status = hs.Status()
+	assert.Equal(t, float64(1), status.Apdex)
+	assert.Equal(t, uint64(0), status.ApdexSatisfied)
+	assert.Equal(t, float64(1), status.Windows[0].Apdex)
+}
@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"log"
+	"maps"
 	"net/http"
 	"os"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
@@ -25,6 +29,26 @@ const (
 	// MergedLabelValue is the placeholder value for merged metrics.
 	MergedLabelValue = "MERGED_LABEL"
 
+	// DefaultUnmatchedRoutePath is the default path label of the requests not matching any route.
+	DefaultUnmatchedRoutePath = "UNMATCHED"
+	// OtherMethod is the method label of the requests with non-standard http methods.
+	OtherMethod = "OTHER"
+	// OverflowRoutePath is the path label of the requests exceeding MaxHTTPRoutes.
+	OverflowRoutePath = "OVERFLOW"
+
+	// DirectionServer is the direction of the inbound requests served by the service.
+	DirectionServer = "server"
+	// DirectionClient is the direction of the outbound requests sent by the service to the other services.
+	DirectionClient = "client"
+
+	// defaultMaxHTTPRoutes is the default max number of the distinct routes of http stats.
+	defaultMaxHTTPRoutes = 1000
+	// notificationQueueSize is the max number of the queued notifications.
+	notificationQueueSize = 100
+
+	// DefaultApdexTarget is the default Apdex target T of the http requests.
+	DefaultApdexTarget = 500 * time.Millisecond
+
 	MetricTypeGaugeVec     MetricType = "GaugeVec"
 	MetricTypeCounterVec   MetricType = "CounterVec"
 	MetricTypeSummaryVec   MetricType = "SummaryVec"
@@ -35,7 +59,18 @@ const (
 )
 
 var (
+	// builtinHTTPLabels are the label keys used by the http metrics.
+	builtinHTTPLabels = []string{
+		"service_name", "type", "host_name", "method", "path", "direction", "target",
+		"code", "class", "window", "cause",
+	}
+
 	defaultExcludedHttpPath = []string{"/metrics", "/actuator/health"}
+
+	standardMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+	}
 )
 
 // MetricsHub wraps Prometheus metrics for monitoring purposes.
@@ -77,22 +112,165 @@ type (
 
 		// ExcludedHttpPath is the list of excluded http paths.
 		// Default is ["/metrics", "/actuator/health"].
+		// Besides the exact path, it supports glob ("/debug/pprof/*", "/static/**"),
+		// regular expression ("re:^/internal/") and method-aware ("OPTIONS *") patterns,
+		// see PathMatcher for details. A path ending with "/", e.g. "/api/", is still exact,
+		// use "/api/**" to exclude the subtree.
 		// +optional
 		ExcludedHttpPath []string `yaml:"excludedHttpPath" json:"excludedHttpPath"`
+
+		// IncludedHttpPath is the list of included http paths, the patterns are the same as ExcludedHttpPath.
+		// If set, only the matched http requests will be collected, and ExcludedHttpPath still applies.
+		// +optional
+		IncludedHttpPath []string `yaml:"includedHttpPath" json:"includedHttpPath"`
+
+		// LatencyWindows is the list of rolling windows for the min, max and mean
+		// duration of the http requests.
+		// Default is [1m, 5m, 15m].
+		// +optional
+		LatencyWindows []Duration `yaml:"latencyWindows" json:"latencyWindows"`
+
+		// ErrorClassifier classifies the http requests into client errors and server errors.
+		// Default is DefaultErrorClassifier, which treats 4xx as client errors and 5xx as server errors.
+		// +optional
+		ErrorClassifier ErrorClassifier `yaml:"-" json:"-"`
+		// RouteErrorClassifiers overrides the ErrorClassifier for the specific routes,
+		// the key is the route path, e.g. "/api/v1/vm/:id".
+		// +optional
+		RouteErrorClassifiers map[string]ErrorClassifier `yaml:"-" json:"-"`
+
+		// CollapseStatusCodes is the flag to collapse the status codes to their class
+		// in the http_responses_total metric, e.g. 503 is exported as code="5xx".
+		// It is used to bound the cardinality of the metric.
+		// Default is false.
+		// +optional
+		CollapseStatusCodes bool `yaml:"collapseStatusCodes" json:"collapseStatusCodes"`
+
+		// PathNormalizer is the configuration to normalize the raw URL paths,
+		// it is used by the middlewares when the route template is not available.
+		// Default is to collapse UUIDs, emails, numeric IDs and hex hashes, see PathNormalizerConfig.
+		// +optional
+		PathNormalizer *PathNormalizerConfig `yaml:"pathNormalizer" json:"pathNormalizer"`
+
+		// UnmatchedRoutePath is the path label of the requests not matching any route,
+		// e.g. the 404 responses to the scanners hitting random URLs.
+		// Default is "UNMATCHED".
+		// +optional
+		UnmatchedRoutePath string `yaml:"unmatchedRoutePath" json:"unmatchedRoutePath"`
+
+		// MaxHTTPRoutes is the max number of the distinct method and path pairs of the inbound
+		// requests in the http stats. The requests of the new routes exceeding the limit are
+		// collected into the "OVERFLOW" path.
+		// Default is 1000, negative means no limit.
+		// +optional
+		MaxHTTPRoutes int `yaml:"maxHTTPRoutes" json:"maxHTTPRoutes"`
+
+		// MaxClientHTTPRoutes is the max number of the distinct target, method and path of the
+		// outbound requests in the http stats, it is limited separately from MaxHTTPRoutes.
+		// Default is 1000, negative means no limit.
+		// +optional
+		MaxClientHTTPRoutes int `yaml:"maxClientHTTPRoutes" json:"maxClientHTTPRoutes"`
+
+		// MaxConcurrency is the max number of the concurrent http requests the service
+		// could serve, e.g. the size of the worker pool. It is used to calculate the
+		// utilization, which is the concurrency derived by Little's law divided by it.
+		// Default is 0, which means the utilization is not calculated.
+		// +optional
+		MaxConcurrency int `yaml:"maxConcurrency" json:"maxConcurrency"`
+
+		// HTTPExtraLabels is the list of the extra label keys of the http metrics, e.g. "tenant".
+		// The label keys must be declared here, so the metric vectors are created with them,
+		// and the values are set by RequestMetric.Labels, e.g. by the extractors of the middlewares.
+		// They only label the inbound requests, they are empty for the client direction.
+		// The invalid keys and the keys conflicting with the builtin labels are ignored.
+		// +optional
+		HTTPExtraLabels []string `yaml:"httpExtraLabels" json:"httpExtraLabels"`
+
+		// SampleCapture is the configuration to capture the slowest and the error requests
+		// of each route, which are served by DebugHandler.
+		// Default is nil, which means the capture is disabled.
+		// +optional
+		SampleCapture *SampleCaptureConfig `yaml:"sampleCapture" json:"sampleCapture"`
+
+		// ApdexTarget is the Apdex target T of the http requests, the requests served
+		// within T are satisfied, within 4T are tolerating, and the others or the errors
+		// are frustrated.
+		// Default is 500ms.
+		// +optional
+		ApdexTarget Duration `yaml:"apdexTarget" json:"apdexTarget"`
+		// RouteApdexTargets overrides the ApdexTarget for the routes matching the patterns,
+		// the first matching rule wins.
+		// +optional
+		RouteApdexTargets []ApdexTargetRule `yaml:"routeApdexTargets" json:"routeApdexTargets"`
+
+		// SLOs is the list of the service level objectives of the inbound http requests,
+		// their error budgets and burn rates are exported, and the burn rate alerts
+		// are notified by NotifyResult.
+		// +optional
+		SLOs []SLOConfig `yaml:"slos" json:"slos"`
+
+		// AlertRules is the list of the alert rules evaluated every statistic tick,
+		// the firing and the resolved alerts are notified by NotifyResult.
+		// More rules could be added by AddAlertRule.
+		// +optional
+		AlertRules []AlertRule `yaml:"alertRules" json:"alertRules"`
+	}
+
+	// ApdexTargetRule is the Apdex target T of the routes matching the pattern.
+	ApdexTargetRule struct {
+		// Pattern is the route pattern, it is the same as MetricsHubConfig.ExcludedHttpPath,
+		// e.g. "/api/v1/reports/**", "POST /api/v1/upload".
+		Pattern string `yaml:"pattern" json:"pattern"`
+		// Target is the Apdex target T of the matched routes.
+		Target Duration `yaml:"target" json:"target"`
+	}
+
+	// apdexTarget is the compiled ApdexTargetRule.
+	apdexTarget struct {
+		matcher *PathMatcher
+		target  time.Duration
 	}
 
 	MetricsHub struct {
-		config               *MetricsHubConfig
-		registry             *prometheus.Registry
-		metricsRegistrations map[string]*MetricRegistration
-		httpMetrics          *httpRequestMetrics
-		httpStats            map[httpStatsKey]*HTTPStat
-		fixedLabels          prometheus.Labels
+		config                 *MetricsHubConfig
+		registry               *prometheus.Registry
+		metricsMutex           sync.RWMutex
+		metricsRegistrations   map[string]*MetricRegistration
+		httpMetrics            *httpRequestMetrics
+		clientMetrics          *httpRequestMetrics
+		httpStatsMutex         sync.RWMutex
+		httpStats              map[httpStatsKey]*HTTPStat
+		httpStatus             map[httpStatsKey]*Status
+		httpRoutes             map[string]int
+		overflowRequests       uint64
+		clientOverflowRequests uint64
+		inFlight               uint64
+		inFlightPeak           uint64
+		fixedLabels            prometheus.Labels
+		excludedPaths          *PathMatcher
+		includedPaths          *PathMatcher
+		pathNormalizer         *PathNormalizer
+		extraLabelKeys         []string
+		apdexTargets           []apdexTarget
+		slos                   []*sloTracker
+		sloRoutes              sync.Map
+		alertsMutex            sync.Mutex
+		alertRules             []*alertRule
+		alerts                 map[string]*Alert
+		// samples is the *requestSamples keyed by httpStatsKey.
+		samples sync.Map
+		vecs    *metricVecs
+		// notifications is the queue of the results sent in order.
+		notifications chan *Result
 	}
 
 	httpStatsKey struct {
-		Method string
-		Path   string
+		Direction string
+		Target    string
+		Method    string
+		Path      string
+		// Extra is the encoded extra labels, see encodeExtraLabels.
+		Extra string
 	}
 
 	MetricType string
@@ -137,6 +315,10 @@ func NewMetricsHub(config *MetricsHubConfig) *MetricsHub {
 		registry:             reg,
 		metricsRegistrations: make(map[string]*MetricRegistration),
 		httpStats:            make(map[httpStatsKey]*HTTPStat),
+		httpRoutes:           make(map[string]int),
+		alerts:               make(map[string]*Alert),
+		notifications:        make(chan *Result, notificationQueueSize),
+		vecs:                 newMetricVecs(),
 	}
 
 	if !hub.config.DisableFixedLabels {
@@ -145,21 +327,215 @@ func NewMetricsHub(config *MetricsHubConfig) *MetricsHub {
 	if hub.config.ExcludedHttpPath == nil {
 		hub.config.ExcludedHttpPath = make([]string, 0)
 	}
+	if hub.config.UnmatchedRoutePath == "" {
+		hub.config.UnmatchedRoutePath = DefaultUnmatchedRoutePath
+	}
+	if hub.config.MaxHTTPRoutes == 0 {
+		hub.config.MaxHTTPRoutes = defaultMaxHTTPRoutes
+	}
+	if hub.config.MaxClientHTTPRoutes == 0 {
+		hub.config.MaxClientHTTPRoutes = defaultMaxHTTPRoutes
+	}
+	if len(hub.config.LatencyWindows) == 0 {
+		for _, w := range DefaultLatencyWindows() {
+			hub.config.LatencyWindows = append(hub.config.LatencyWindows, Duration(w))
+		}
+	}
+	if hub.config.ApdexTarget <= 0 {
+		hub.config.ApdexTarget = Duration(DefaultApdexTarget)
+	}
 	if !hub.config.DisableDefaultExcludedHttpPath {
 		hub.config.ExcludedHttpPath = append(hub.config.ExcludedHttpPath, defaultExcludedHttpPath...)
 	}
-	hub.httpMetrics = hub.newHTTPMetrics()
+	var err error
+	hub.excludedPaths, err = NewPathMatcher(hub.config.ExcludedHttpPath)
+	if err != nil {
+		log.Printf("compile excluded http paths failed: %v", err)
+	}
+	hub.includedPaths, err = NewPathMatcher(hub.config.IncludedHttpPath)
+	if err != nil {
+		log.Printf("compile included http paths failed: %v", err)
+	}
+	hub.pathNormalizer, err = NewPathNormalizer(hub.config.PathNormalizer)
+	if err != nil {
+		log.Printf("compile path normalizer failed: %v", err)
+	}
+	hub.extraLabelKeys = hub.validExtraLabelKeys()
+	hub.apdexTargets = hub.compileApdexTargets()
+	hub.slos = hub.newSLOTrackers()
+	for _, rule := range hub.config.AlertRules {
+		if err := hub.AddAlertRule(rule); err != nil {
+			log.Printf("add alert rule failed: %v", err)
+		}
+	}
+	if hub.config.SampleCapture != nil {
+		normalizeSampleCaptureConfig(hub.config.SampleCapture)
+	}
+	hub.httpMetrics = hub.newHTTPMetrics(DirectionServer)
+	hub.clientMetrics = hub.newHTTPMetrics(DirectionClient)
 
 	go hub.run()
+	go hub.sendNotifications()
 
 	return hub
 }
 
+// IsExcludedHttpPath returns true if the http path should not be collected.
+// Only the patterns without a method are considered, use IsExcludedHttpRequest
+// if the method is known.
 func (hub *MetricsHub) IsExcludedHttpPath(path string) bool {
-	if hub.config.ExcludedHttpPath == nil {
-		return false
+	return hub.IsExcludedHttpRequest("", path)
+}
+
+// IsExcludedHttpRequest returns true if the http request should not be collected.
+func (hub *MetricsHub) IsExcludedHttpRequest(method, path string) bool {
+	if hub.excludedPaths.Match(method, path) {
+		return true
+	}
+	if !hub.includedPaths.Empty() && !hub.includedPaths.Match(method, path) {
+		return true
+	}
+	return false
+}
+
+// RoutePath returns the path label of the request for the middlewares.
+// The route is the registered route template, the requests without a route template
+// are grouped into UnmatchedRoutePath if they are 404 or 405, otherwise the
+// normalized raw path is used.
+func (hub *MetricsHub) RoutePath(route, rawPath string, statusCode int) string {
+	if route != "" {
+		return route
+	}
+	if statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed {
+		return hub.config.UnmatchedRoutePath
+	}
+	return hub.NormalizePath(rawPath)
+}
+
+// OverflowHTTPRequests returns the number of the requests collected into the
+// overflow path because of MaxHTTPRoutes, i.e. it counts the requests rather than the routes.
+func (hub *MetricsHub) OverflowHTTPRequests() uint64 {
+	return atomic.LoadUint64(&hub.overflowRequests)
+}
+
+// OverflowClientHTTPRequests returns the number of the outbound requests collected
+// into the overflow path because of MaxClientHTTPRoutes.
+func (hub *MetricsHub) OverflowClientHTTPRequests() uint64 {
+	return atomic.LoadUint64(&hub.clientOverflowRequests)
+}
+
+// NormalizePath normalizes the raw URL path to a low cardinality route path,
+// it should be used when the route template is not available.
+func (hub *MetricsHub) NormalizePath(path string) string {
+	return hub.pathNormalizer.Normalize(path)
+}
+
+// validExtraLabelKeys returns the valid keys of HTTPExtraLabels.
+func (hub *MetricsHub) validExtraLabelKeys() []string {
+	var keys []string
+	for _, key := range hub.config.HTTPExtraLabels {
+		switch {
+		case !ValidateLabelName(key):
+			log.Printf("invalid http extra label: %s", key)
+		case slices.Contains(builtinHTTPLabels, key) || hasKey(hub.config.Labels, key):
+			log.Printf("http extra label %s conflicts with the builtin labels", key)
+		case slices.Contains(keys, key):
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, exists := m[key]
+	return exists
+}
+
+// encodeExtraLabels encodes the values of the extra labels into a comparable string,
+// the missing values are empty and the undeclared keys are ignored.
+func (hub *MetricsHub) encodeExtraLabels(labels map[string]string) string {
+	if len(hub.extraLabelKeys) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, key := range hub.extraLabelKeys {
+		sb.WriteString(key)
+		sb.WriteByte(0)
+		sb.WriteString(labels[key])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+// extraLabels decodes the extra labels encoded by encodeExtraLabels.
+func (key httpStatsKey) extraLabels() map[string]string {
+	if key.Extra == "" {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSuffix(key.Extra, "\x00"), "\x00")
+	labels := make(map[string]string, len(parts)/2)
+	for i := 0; i+1 < len(parts); i += 2 {
+		labels[parts[i]] = parts[i+1]
+	}
+	return labels
+}
+
+// errorClassifier returns the error classifier for the path.
+func (hub *MetricsHub) errorClassifier(path string) ErrorClassifier {
+	if classifier, exists := hub.config.RouteErrorClassifiers[path]; exists {
+		return classifier
 	}
-	return slices.Contains(hub.config.ExcludedHttpPath, path)
+	return hub.config.ErrorClassifier
+}
+
+// compileApdexTargets compiles RouteApdexTargets, the invalid rules are skipped.
+func (hub *MetricsHub) compileApdexTargets() []apdexTarget {
+	var targets []apdexTarget
+	for _, rule := range hub.config.RouteApdexTargets {
+		if rule.Target <= 0 {
+			log.Printf("invalid apdex target of %s: %v", rule.Pattern, rule.Target)
+			continue
+		}
+		matcher, err := NewPathMatcher([]string{rule.Pattern})
+		if err != nil {
+			log.Printf("compile apdex target pattern failed: %v", err)
+			continue
+		}
+		targets = append(targets, apdexTarget{matcher: matcher, target: time.Duration(rule.Target)})
+	}
+	return targets
+}
+
+// apdexTarget returns the Apdex target T of the route.
+func (hub *MetricsHub) apdexTarget(method, path string) time.Duration {
+	for _, t := range hub.apdexTargets {
+		if t.matcher.Match(method, path) {
+			return t.target
+		}
+	}
+	return time.Duration(hub.config.ApdexTarget)
+}
+
+// CommonLabels returns the labels of the metrics of the type shared by the whole service,
+// which are the service_name, the type, the host_name if it is enabled and the Labels of
+// the config. The metrics built by the vec constructors are curried with them.
+func (hub *MetricsHub) CommonLabels(metricType string) prometheus.Labels {
+	labels := prometheus.Labels{
+		"service_name": hub.config.ServiceName,
+		"type":         metricType,
+	}
+	if hub.config.EnableHostNameLabel {
+		if hub.config.HostName == "" {
+			hostname, _ := os.Hostname()
+			hub.config.HostName = hostname
+		}
+		labels["host_name"] = hub.config.HostName
+	}
+	for k, v := range hub.config.Labels {
+		labels[k] = v
+	}
+	return labels
 }
 
 func (hub *MetricsHub) getFixedLabels() prometheus.Labels {
@@ -198,17 +574,115 @@ func (hub *MetricsHub) run() {
 
 	for {
 		select {
-		case <-ticker.C:
-			for key, stats := range hub.httpStats {
-				status := stats.Status()
-				hub.httpMetrics.exportPrometheusMetricsForTicker(status, key.Method, key.Path)
+		case now := <-ticker.C:
+			hub.updateHTTPStatus()
+			hub.evaluateAlerts(now)
+		}
+	}
+}
+
+// updateHTTPStatus generates the status of all http stats, and exports them to prometheus.
+func (hub *MetricsHub) updateHTTPStatus() {
+	hub.httpStatsMutex.RLock()
+	stats := maps.Clone(hub.httpStats)
+	hub.httpStatsMutex.RUnlock()
+
+	statuses := make(map[httpStatsKey]*Status, len(stats))
+	concurrency := 0.0
+	for key, stat := range stats {
+		status := stat.Status()
+		// MaxConcurrency is the capacity of the server, the outbound requests don't use it.
+		if key.Direction == DirectionServer {
+			concurrency += status.Concurrency
+			if hub.config.MaxConcurrency > 0 {
+				status.Utilization = status.Concurrency / float64(hub.config.MaxConcurrency)
 			}
 		}
+		statuses[key] = status
+		hub.metricsOf(key).exportPrometheusMetricsForTicker(status, stat.labels)
+	}
+
+	inFlight := atomic.LoadUint64(&hub.inFlight)
+	peak := max(atomic.SwapUint64(&hub.inFlightPeak, inFlight), inFlight)
+	hub.httpMetrics.ServicePeakConcurrency.Set(float64(peak))
+	hub.httpMetrics.ServiceConcurrency.Set(concurrency)
+	if hub.config.MaxConcurrency > 0 {
+		hub.httpMetrics.ServiceUtilization.Set(concurrency / float64(hub.config.MaxConcurrency))
+	}
+	hub.updateSLOs()
+
+	hub.httpStatsMutex.Lock()
+	hub.httpStatus = statuses
+	hub.httpStatsMutex.Unlock()
+}
+
+// getHTTPStat returns the http stat of the key, creates it if not exists.
+// If the number of the routes of the direction exceeds MaxHTTPRoutes or MaxClientHTTPRoutes,
+// the stat of the overflow route is returned, the returned key is the actual key of the stat,
+// and the overflow request is counted if countOverflow is true.
+func (hub *MetricsHub) getHTTPStat(key httpStatsKey, countOverflow bool) (httpStatsKey, *HTTPStat) {
+	hub.httpStatsMutex.RLock()
+	stat, exists := hub.httpStats[key]
+	hub.httpStatsMutex.RUnlock()
+	if exists {
+		return key, stat
+	}
+
+	hub.httpStatsMutex.Lock()
+	defer hub.httpStatsMutex.Unlock()
+	if stat, exists = hub.httpStats[key]; exists {
+		return key, stat
+	}
+
+	maxRoutes, overflow := hub.config.MaxHTTPRoutes, &hub.overflowRequests
+	if key.Direction == DirectionClient {
+		maxRoutes, overflow = hub.config.MaxClientHTTPRoutes, &hub.clientOverflowRequests
+	}
+	if maxRoutes > 0 && hub.httpRoutes[key.Direction] >= maxRoutes {
+		if countOverflow {
+			atomic.AddUint64(overflow, 1)
+			if m := hub.metricsOf(key); m != nil {
+				m.OverflowRequests.Inc()
+			}
+		}
+		key = httpStatsKey{
+			Direction: key.Direction,
+			Target:    key.Target,
+			Method:    key.Method,
+			Path:      OverflowRoutePath,
+			Extra:     key.Extra,
+		}
+		if stat, exists = hub.httpStats[key]; exists {
+			return key, stat
+		}
+	}
+
+	windows := make([]time.Duration, len(hub.config.LatencyWindows))
+	for i, w := range hub.config.LatencyWindows {
+		windows[i] = time.Duration(w)
+	}
+	stat = NewHTTPStatWithWindows(windows)
+	stat.apdexTarget = hub.apdexTarget(key.Method, key.Path)
+	stat.extraLabels = key.extraLabels()
+	stat.labels = key.labels(stat.extraLabels)
+	hub.httpStats[key] = stat
+	hub.httpRoutes[key.Direction]++
+	return key, stat
+}
+
+// metricsOf returns the prometheus metrics of the direction of the key.
+func (hub *MetricsHub) metricsOf(key httpStatsKey) *httpRequestMetrics {
+	if key.Direction == DirectionClient {
+		return hub.clientMetrics
 	}
+	return hub.httpMetrics
 }
 
 // RegisterMetric registers a new metric with the hub.
 func (hub *MetricsHub) RegisterMetric(reg *MetricRegistration) error {
+	hub.metricsMutex.Lock()
+	defer hub.metricsMutex.Unlock()
+
 	if _, exists := hub.metricsRegistrations[reg.Name]; exists {
 		return fmt.Errorf("metric %s already exists", reg.Name)
 	}
@@ -219,7 +693,6 @@ func (hub *MetricsHub) RegisterMetric(reg *MetricRegistration) error {
 			}
 		}
 	}
-	hub.metricsRegistrations[reg.Name] = reg
 
 	var collector prometheus.Collector
 	switch reg.Type {
@@ -236,12 +709,22 @@ func (hub *MetricsHub) RegisterMetric(reg *MetricRegistration) error {
 	}
 
 	reg.collector = collector
+	hub.metricsRegistrations[reg.Name] = reg
 
 	return nil
 }
 
+// registration returns the registration of the custom metric.
+func (hub *MetricsHub) registration(name string) (*MetricRegistration, bool) {
+	hub.metricsMutex.RLock()
+	defer hub.metricsMutex.RUnlock()
+	reg, exists := hub.metricsRegistrations[name]
+	return reg, exists
+}
+
 func (hub *MetricsHub) GetCollector(name string) prometheus.Collector {
-	return hub.metricsRegistrations[name].collector
+	reg, _ := hub.registration(name)
+	return reg.collector
 }
 
 // HTTPHandler returns an HTTP handler for the metrics endpoint.
@@ -251,6 +734,9 @@ func (hub *MetricsHub) HTTPHandler() http.Handler {
 
 // CurrentMetrics returns a snapshot of all custom metrics registered with the hub.
 func (hub *MetricsHub) CurrentMetrics() []string {
+	hub.metricsMutex.RLock()
+	defer hub.metricsMutex.RUnlock()
+
 	var metricNames []string
 	for name := range hub.metricsRegistrations {
 		metricNames = append(metricNames, name)
@@ -264,7 +750,7 @@ func (hub *MetricsHub) UpdateMetrics(name string, value float64, labels map[stri
 	if labels == nil {
 		labels = make(map[string]string)
 	}
-	metricReg, exists := hub.metricsRegistrations[name]
+	metricReg, exists := hub.registration(name)
 	if !exists {
 		return nil // RequestMetric not found
 	}
@@ -299,7 +785,7 @@ func (hub *MetricsHub) UpdateMetrics(name string, value float64, labels map[stri
 // IncMetrics increments a metric by 1.
 // It only works for GaugeVec and CounterVec, other types will return an error.
 func (hub *MetricsHub) IncMetrics(name string, labels map[string]string) error {
-	metricReg, exists := hub.metricsRegistrations[name]
+	metricReg, exists := hub.registration(name)
 	if !exists {
 		return nil // RequestMetric not found
 	}
@@ -326,7 +812,7 @@ func (hub *MetricsHub) IncMetrics(name string, labels map[string]string) error {
 // DecMetrics decrements a metric by 1.
 // It only works for GaugeVec, other types will return an error.
 func (hub *MetricsHub) DecMetrics(name string, labels map[string]string) error {
-	metricReg, exists := hub.metricsRegistrations[name]
+	metricReg, exists := hub.registration(name)
 	if !exists {
 		return nil // RequestMetric not found
 	}
@@ -350,33 +836,107 @@ func (hub *MetricsHub) DecMetrics(name string, labels map[string]string) error {
 
 // UpdateHTTPRequestMetrics updates the HTTP request metrics.
 // Do not call this method directly, use the middleware instead.
-// Or only when you need to call the third-party API, and statistics are needed.
+// The outbound requests to the third-party APIs should be collected by
+// NewInstrumentedTransport or UpdateClientRequestMetrics.
+// The non-standard methods are collected as "OTHER", and the empty path is
+// collected as UnmatchedRoutePath.
 func (hub *MetricsHub) UpdateHTTPRequestMetrics(requestMetric *RequestMetric, method, path string) {
-	key := httpStatsKey{
-		Method: method,
-		Path:   path,
+	hub.updateRequestMetrics(requestMetric, httpStatsKey{
+		Direction: DirectionServer,
+		Method:    method,
+		Path:      path,
+	})
+}
+
+// UpdateClientRequestMetrics updates the metrics of the outbound request sent to the target,
+// they are collected into the client direction, which has the same statistics as the
+// server direction, and the metrics are labeled by direction="client" and the target.
+// Do not call this method directly, use the client interceptors or transports instead.
+func (hub *MetricsHub) UpdateClientRequestMetrics(requestMetric *RequestMetric, target, method, path string) {
+	hub.updateRequestMetrics(requestMetric, httpStatsKey{
+		Direction: DirectionClient,
+		Target:    target,
+		Method:    method,
+		Path:      path,
+	})
+}
+
+// TrackHTTPRequest marks an http request is being served, and returns the function
+// to call when it is finished. The route is the route path if it is known before the
+// request is served, otherwise it is empty and only the service-wide in-flight requests
+// are tracked. The rawPath is used to check the excluded paths if the route is empty.
+// The in-flight requests of the route are tracked without the extra labels.
+// Do not call this method directly, use the middleware instead.
+func (hub *MetricsHub) TrackHTTPRequest(method, route, rawPath string) (done func()) {
+	path := route
+	if path == "" {
+		path = rawPath
+	}
+	if hub.IsExcludedHttpRequest(method, path) {
+		return func() {}
 	}
 
-	stat, exists := hub.httpStats[key]
-	if !exists {
-		stat = NewHTTPStat()
-		hub.httpStats[key] = stat
+	updateMax(&hub.inFlightPeak, atomic.AddUint64(&hub.inFlight, 1))
+	hub.httpMetrics.ServiceInFlight.Inc()
+	if route == "" {
+		return func() {
+			atomic.AddUint64(&hub.inFlight, ^uint64(0))
+			hub.httpMetrics.ServiceInFlight.Dec()
+		}
 	}
 
-	if stat == nil {
+	_, stat := hub.getHTTPStat(hub.normalizeKey(httpStatsKey{
+		Direction: DirectionServer,
+		Method:    method,
+		Path:      route,
+	}, nil), false)
+	stat.Begin()
+	inFlight := hub.httpMetrics.InFlight.With(stat.labels)
+	inFlight.Inc()
+	return func() {
+		stat.End()
+		inFlight.Dec()
+		atomic.AddUint64(&hub.inFlight, ^uint64(0))
+		hub.httpMetrics.ServiceInFlight.Dec()
+	}
+}
+
+// normalizeKey collects the non-standard methods as OtherMethod, and the
+// empty path as UnmatchedRoutePath, and encodes the extra labels of the
+// server direction.
+func (hub *MetricsHub) normalizeKey(key httpStatsKey, labels map[string]string) httpStatsKey {
+	if key.Direction == DirectionServer {
+		key.Extra = hub.encodeExtraLabels(labels)
+	}
+	if !slices.Contains(standardMethods, key.Method) {
+		key.Method = OtherMethod
+	}
+	if key.Path == "" {
+		key.Path = hub.config.UnmatchedRoutePath
+	}
+	return key
+}
+
+func (hub *MetricsHub) updateRequestMetrics(requestMetric *RequestMetric, key httpStatsKey) {
+	if requestMetric == nil {
 		return
 	}
 
-	if hub.httpMetrics == nil {
+	key, stat := hub.getHTTPStat(hub.normalizeKey(key, requestMetric.Labels), true)
+	if stat == nil {
 		return
 	}
 
-	if requestMetric == nil {
+	metrics := hub.metricsOf(key)
+	if metrics == nil {
 		return
 	}
 
+	requestMetric.classify(hub.errorClassifier(key.Path))
 	stat.Stat(requestMetric)
-	hub.httpMetrics.exportPrometheusMetricsForRequestMetric(requestMetric, method, path)
+	metrics.exportPrometheusMetricsForRequestMetric(requestMetric, stat.labels)
+	hub.captureSample(requestMetric, key)
+	hub.observeSLOs(requestMetric, key)
 }
 
 // NotifyMessage sends a message to backend, for now, we only support Slack.
@@ -391,8 +951,28 @@ func (hub *MetricsHub) NotifyResult(result *Result) error {
 	return notifyResult(hub.config, result)
 }
 
+// notifyInOrder queues the result to be sent by one goroutine, so the results are sent
+// in the order they are queued, e.g. a resolved alert after its firing one.
+// The result is dropped if the queue is full.
+func (hub *MetricsHub) notifyInOrder(result *Result) {
+	select {
+	case hub.notifications <- result:
+	default:
+		log.Printf("notification queue is full, drop %s", result.UID)
+	}
+}
+
+// sendNotifications sends the queued results.
+func (hub *MetricsHub) sendNotifications() {
+	for result := range hub.notifications {
+		if err := hub.NotifyResult(result); err != nil {
+			log.Printf("notify %s failed: %v", result.UID, err)
+		}
+	}
+}
+
 func (hub *MetricsHub) CollectMergedMetrics(name string, mergedLabels []string) error {
-	reg, exists := hub.metricsRegistrations[name]
+	reg, exists := hub.registration(name)
 	if !exists {
 		return errors.New("metric not found")
 	}
@@ -536,7 +1116,7 @@ func (hub *MetricsHub) GetMetricValue(m *dto.Metric, metricType MetricType) floa
 }
 
 func (hub *MetricsHub) GetMetricCurrentValue(name string, labels map[string]string) (float64, error) {
-	metricReg, exists := hub.metricsRegistrations[name]
+	metricReg, exists := hub.registration(name)
 	if !exists {
 		return 0, nil
 	}
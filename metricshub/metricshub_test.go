@@ -3,6 +3,7 @@ package metricshub
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
@@ -155,3 +156,279 @@ func TestMergedMetrics2(t *testing.T) {
 		fmt.Printf("value: %f, labels: %v\n", value, m.GetLabel())
 	}
 }
+
+func gatherMetrics(t *testing.T, hub *MetricsHub, name string) []*dto.Metric {
+	mfs, err := hub.registry.Gather()
+	assert.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return mf.GetMetric()
+		}
+	}
+	return nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func counterValue(t *testing.T, hub *MetricsHub, name, label, value string) float64 {
+	for _, m := range gatherMetrics(t, hub, name) {
+		if label == "" || labelValue(m, label) == value {
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestHTTPResponsesByCode(t *testing.T) {
+	for _, collapse := range []bool{false, true} {
+		hub := NewMetricsHub(&MetricsHubConfig{
+			ServiceName:         "test",
+			CollapseStatusCodes: collapse,
+		})
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200}, "GET", "/vm")
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 503}, "GET", "/vm")
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 504}, "GET", "/vm")
+
+		counts := make(map[string]float64)
+		for _, m := range gatherMetrics(t, hub, "http_responses_total") {
+			counts[labelValue(m, "code")+"/"+labelValue(m, "class")] = m.GetCounter().GetValue()
+		}
+		if collapse {
+			assert.Equal(t, map[string]float64{"2xx/2xx": 1, "5xx/5xx": 2}, counts)
+		} else {
+			assert.Equal(t, map[string]float64{"200/2xx": 1, "503/5xx": 1, "504/5xx": 1}, counts)
+		}
+	}
+}
+
+func TestHTTPRouteCardinalityGuard(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:   "test",
+		MaxHTTPRoutes: 3,
+	})
+
+	assert.Equal(t, "/vm/:id", hub.RoutePath("/vm/:id", "/vm/1", 404))
+	assert.Equal(t, DefaultUnmatchedRoutePath, hub.RoutePath("", "/wp-admin.php", 404))
+	assert.Equal(t, "/vm/:id", hub.RoutePath("", "/vm/12", 200))
+
+	m := &RequestMetric{StatusCode: 200}
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/a")
+	hub.UpdateHTTPRequestMetrics(m, "PROPFIND", "/a")
+	hub.UpdateHTTPRequestMetrics(m, "GARBAGE", "/a")
+	hub.UpdateHTTPRequestMetrics(m, "GET", "")
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/b")
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/c")
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/a")
+	hub.updateHTTPStatus()
+
+	routes, err := hub.HTTPStatus(nil)
+	assert.NoError(t, err)
+	counts := make(map[string]uint64)
+	for _, r := range routes {
+		counts[r.Method+" "+r.Path] = r.Count
+	}
+	assert.Equal(t, map[string]uint64{
+		"GET /a":                           2,
+		"OTHER /a":                         2,
+		"GET " + DefaultUnmatchedRoutePath: 1,
+		"GET " + OverflowRoutePath:         2,
+	}, counts)
+	assert.Equal(t, uint64(2), hub.OverflowHTTPRequests())
+}
+
+func TestHTTPRouteCardinalityGuardPerDirection(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:         "test",
+		MaxHTTPRoutes:       1,
+		MaxClientHTTPRoutes: 2,
+	})
+
+	m := &RequestMetric{StatusCode: 200}
+	hub.UpdateClientRequestMetrics(m, "storage:9090", "GET", "/a")
+	hub.UpdateClientRequestMetrics(m, "storage:9090", "GET", "/b")
+	hub.UpdateClientRequestMetrics(m, "storage:9090", "GET", "/c")
+	// the client routes do not consume the budget of the server routes.
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/a")
+	hub.UpdateHTTPRequestMetrics(m, "GET", "/b")
+
+	assert.Equal(t, uint64(1), hub.OverflowHTTPRequests())
+	assert.Equal(t, uint64(1), hub.OverflowClientHTTPRequests())
+	assert.Len(t, gatherMetrics(t, hub, "http_stats_overflow_requests_total"), 2)
+	assert.Equal(t, float64(1), counterValue(t, hub, "http_stats_overflow_requests_total", "direction", DirectionServer))
+	assert.Equal(t, float64(1), counterValue(t, hub, "http_stats_overflow_requests_total", "direction", DirectionClient))
+}
+
+func TestClientRequestMetrics(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200}, "GET", "/vm")
+	hub.UpdateClientRequestMetrics(&RequestMetric{StatusCode: 200}, "storage:9090", "GET", "/vm")
+	hub.UpdateClientRequestMetrics(&RequestMetric{StatusCode: 504, Cause: CauseDeadlineExceeded}, "storage:9090", "GET", "/vm")
+	hub.updateHTTPStatus()
+
+	// both directions are in the same families labeled by the direction.
+	requests := gatherMetrics(t, hub, "total_requests")
+	assert.Len(t, requests, 2)
+	assert.Equal(t, float64(1), counterValue(t, hub, "total_requests", "direction", DirectionServer))
+	assert.Equal(t, float64(2), counterValue(t, hub, "total_requests", "direction", DirectionClient))
+	for _, m := range requests {
+		if labelValue(m, "direction") == DirectionClient {
+			assert.Equal(t, "storage:9090", labelValue(m, "target"))
+		} else {
+			assert.Equal(t, "", labelValue(m, "target"))
+		}
+	}
+	// the metrics of the concepts of the server are not created for the client direction.
+	assert.Len(t, gatherMetrics(t, hub, "peak_concurrency"), 1)
+
+	failures := gatherMetrics(t, hub, "client_request_failures_total")
+	assert.Len(t, failures, 1)
+	assert.Equal(t, CauseDeadlineExceeded, labelValue(failures[0], "cause"))
+
+	result, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "storage:9090", result[0].Target)
+	assert.Equal(t, uint64(2), result[0].Count)
+	assert.Equal(t, uint64(1), result[0].ServerErrCount)
+}
+
+func TestInFlightRequests(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:    "test",
+		MaxConcurrency: 10,
+	})
+
+	done1 := hub.TrackHTTPRequest("GET", "/vm/:id", "/vm/1")
+	done2 := hub.TrackHTTPRequest("GET", "/vm/:id", "/vm/2")
+	done3 := hub.TrackHTTPRequest("GET", "", "/unknown")
+	noop := hub.TrackHTTPRequest("GET", "", "/metrics")
+
+	inFlight := gatherMetrics(t, hub, "in_flight_requests")
+	if assert.Len(t, inFlight, 1) {
+		assert.Equal(t, "/vm/:id", labelValue(inFlight[0], "path"))
+		assert.Equal(t, float64(2), inFlight[0].GetGauge().GetValue())
+	}
+	assert.Equal(t, float64(3), gatherMetrics(t, hub, "service_in_flight_requests")[0].GetGauge().GetValue())
+
+	done1()
+	done2()
+	done3()
+	noop()
+	assert.Equal(t, float64(0), gatherMetrics(t, hub, "service_in_flight_requests")[0].GetGauge().GetValue())
+
+	// 2 requests of 5s in a tick of 5s, the concurrency is 2.
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 5 * time.Second}, "GET", "/vm/:id")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 5 * time.Second}, "GET", "/vm/:id")
+	// the outbound requests don't use the capacity of the server.
+	hub.UpdateClientRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 5 * time.Second}, "storage:9090", "GET", "/vm")
+	hub.updateHTTPStatus()
+
+	clientResult, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	if assert.Len(t, clientResult, 1) {
+		assert.Equal(t, 1.0, clientResult[0].Concurrency)
+		assert.Equal(t, 0.0, clientResult[0].Utilization)
+	}
+	result, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionServer})
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, uint64(0), result[0].InFlight)
+		assert.Equal(t, uint64(2), result[0].PeakConcurrency)
+		assert.Equal(t, 2.0, result[0].Concurrency)
+		assert.Equal(t, 0.2, result[0].Utilization)
+	}
+	assert.Equal(t, float64(3), gatherMetrics(t, hub, "service_peak_concurrency")[0].GetGauge().GetValue())
+	assert.Equal(t, 0.2, gatherMetrics(t, hub, "service_utilization")[0].GetGauge().GetValue())
+
+	// the peak is reset to the in-flight requests at the next tick.
+	hub.updateHTTPStatus()
+	result, _ = hub.HTTPStatus(nil)
+	assert.Equal(t, uint64(0), result[0].PeakConcurrency)
+	assert.Equal(t, 0.0, result[0].Concurrency)
+	assert.Equal(t, float64(0), gatherMetrics(t, hub, "service_peak_concurrency")[0].GetGauge().GetValue())
+}
+
+func TestHTTPExtraLabels(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:     "test",
+		HTTPExtraLabels: []string{"tenant", "bad-key", "path"},
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Labels: map[string]string{"tenant": "a", "other": "x"}}, "GET", "/vm")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Labels: map[string]string{"tenant": "b"}}, "GET", "/vm")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200}, "GET", "/vm")
+	hub.updateHTTPStatus()
+
+	requests := gatherMetrics(t, hub, "total_requests")
+	assert.Len(t, requests, 3)
+	tenants := map[string]bool{}
+	for _, m := range requests {
+		tenants[labelValue(m, "tenant")] = true
+		assert.Equal(t, "", labelValue(m, "other"))
+		assert.Equal(t, "", labelValue(m, "bad-key"))
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "": true}, tenants)
+
+	result, err := hub.HTTPStatus(nil)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	assert.Equal(t, map[string]string{"tenant": ""}, result[0].Labels)
+	assert.Equal(t, map[string]string{"tenant": "a"}, result[1].Labels)
+
+	// the outbound requests are not labeled by the extra labels.
+	hub.UpdateClientRequestMetrics(&RequestMetric{StatusCode: 200, Labels: map[string]string{"tenant": "a"}}, "storage:9090", "GET", "/vm")
+	hub.updateHTTPStatus()
+	for _, m := range gatherMetrics(t, hub, "total_requests") {
+		if labelValue(m, "direction") == DirectionClient {
+			assert.Equal(t, "", labelValue(m, "tenant"))
+		}
+	}
+	result, err = hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Empty(t, result[0].Labels)
+	}
+}
+
+func TestHTTPApdexTargets(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+		ApdexTarget: Duration(100 * time.Millisecond),
+		RouteApdexTargets: []ApdexTargetRule{
+			{Pattern: "/reports/**", Target: Duration(time.Second)},
+			{Pattern: "POST /upload", Target: Duration(2 * time.Second)},
+			{Pattern: "re:(", Target: Duration(time.Second)},
+			{Pattern: "/invalid", Target: 0},
+		},
+	})
+	assert.Equal(t, time.Second, hub.apdexTarget("GET", "/reports/daily"))
+	assert.Equal(t, 2*time.Second, hub.apdexTarget("POST", "/upload"))
+	assert.Equal(t, 100*time.Millisecond, hub.apdexTarget("GET", "/upload"))
+	assert.Equal(t, 100*time.Millisecond, hub.apdexTarget("GET", "/invalid"))
+
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 300 * time.Millisecond}, "GET", "/reports/daily")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 300 * time.Millisecond}, "GET", "/vm")
+	hub.updateHTTPStatus()
+
+	apdex := map[string]float64{}
+	for _, m := range gatherMetrics(t, hub, "apdex") {
+		apdex[labelValue(m, "path")] = m.GetGauge().GetValue()
+	}
+	assert.Equal(t, map[string]float64{"/reports/daily": 1, "/vm": 0.5}, apdex)
+	assert.Len(t, gatherMetrics(t, hub, "window_apdex"), 2*len(DefaultLatencyWindows()))
+
+	result, err := hub.HTTPStatus(nil)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	for _, status := range result {
+		assert.Equal(t, apdex[status.Path], status.Apdex)
+	}
+}
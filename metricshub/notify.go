@@ -125,9 +125,9 @@ func toSlack(cfg *MetricsHubConfig, r *Result) string {
 	`
 
 	body := fmt.Sprintf("*%s*\\n>%s %s\\n>%s",
-		r.Title, r.Status.Emoji(), r.Endpoint, jsonEscape(r.Message))
+		jsonEscape(r.Title), r.Status.Emoji(), jsonEscape(r.Endpoint), jsonEscape(r.Message))
 	context := slackTimeFormation(r.TimeStamp, " report at ", time.RFC3339)
-	summary := fmt.Sprintf("%s %s - %s", r.Title, r.Status.Emoji(), jsonEscape(r.Message))
+	summary := fmt.Sprintf("%s %s - %s", jsonEscape(r.Title), r.Status.Emoji(), jsonEscape(r.Message))
 	output := fmt.Sprintf(jsonMsg, summary, body, context)
 	if !json.Valid([]byte(output)) {
 		log.Printf("ToSlack() for %s: Invalid JSON: %s", r.UID, output)
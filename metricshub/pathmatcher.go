@@ -0,0 +1,143 @@
+package metricshub
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// anyMethod matches all http methods.
+	anyMethod = "*"
+	// regexpPrefix is the prefix of the regular expression patterns.
+	regexpPrefix = "re:"
+)
+
+type (
+	// PathMatcher matches http requests against a list of patterns.
+	// A pattern is an optional method followed by a path pattern, e.g. "OPTIONS *",
+	// "GET /api/v1/vm". The method "*" or no method matches all methods.
+	// The path pattern supports:
+	//   - exact: "/metrics", "/api/", the paths ending with "/" are exact too
+	//   - glob, "*" matches a path segment, "**" matches any segments: "/debug/pprof/*",
+	//     "/static/**" matches the prefix "/static/"
+	//   - regular expression, starts with "re:": "re:^/internal/.*$"
+	//   - "*" matches all paths.
+	PathMatcher struct {
+		// exact is indexed by method and path.
+		exact map[string]struct{}
+		rules []pathRule
+	}
+
+	pathRule struct {
+		method string
+		// re is nil for "*", which matches all paths.
+		re *regexp.Regexp
+	}
+)
+
+// NewPathMatcher compiles the patterns into a PathMatcher.
+// The invalid patterns are skipped and reported in the returned error,
+// the returned PathMatcher is always usable.
+func NewPathMatcher(patterns []string) (*PathMatcher, error) {
+	m := &PathMatcher{
+		exact: make(map[string]struct{}),
+	}
+
+	var errs []error
+	for _, pattern := range patterns {
+		if err := m.add(pattern); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return m, errors.Join(errs...)
+}
+
+func (m *PathMatcher) add(pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	method, path := anyMethod, pattern
+	if before, after, found := strings.Cut(pattern, " "); found {
+		method, path = strings.ToUpper(before), strings.TrimSpace(after)
+	}
+	if path == "" {
+		return fmt.Errorf("invalid path pattern: %q", pattern)
+	}
+
+	rule := pathRule{method: method}
+	switch {
+	case path == "*":
+	case strings.HasPrefix(path, regexpPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(path, regexpPrefix))
+		if err != nil {
+			return fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+		}
+		rule.re = re
+	case strings.Contains(path, "*"):
+		rule.re = globToRegexp(path)
+	default:
+		m.exact[method+" "+path] = struct{}{}
+		return nil
+	}
+
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// globToRegexp converts the glob pattern to a regular expression,
+// "**" matches any characters and "*" matches any characters except "/".
+func globToRegexp(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		if glob[i] != '*' {
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			continue
+		}
+		if i+1 < len(glob) && glob[i+1] == '*' {
+			sb.WriteString(".*")
+			i++
+		} else {
+			sb.WriteString("[^/]*")
+		}
+	}
+	sb.WriteByte('$')
+	return regexp.MustCompile(sb.String())
+}
+
+// Match returns true if the request matches any pattern.
+// An empty method only matches the patterns for all methods.
+func (m *PathMatcher) Match(method, path string) bool {
+	if m == nil {
+		return false
+	}
+
+	if _, exists := m.exact[anyMethod+" "+path]; exists {
+		return true
+	}
+	if method != "" {
+		if _, exists := m.exact[method+" "+path]; exists {
+			return true
+		}
+	}
+
+	for i := range m.rules {
+		if m.rules[i].match(method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty returns true if there is no pattern in the matcher.
+func (m *PathMatcher) Empty() bool {
+	return m == nil || (len(m.exact) == 0 && len(m.rules) == 0)
+}
+
+func (r *pathRule) match(method, path string) bool {
+	if r.method != anyMethod && r.method != method {
+		return false
+	}
+	return r.re == nil || r.re.MatchString(path)
+}
@@ -0,0 +1,70 @@
+package metricshub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathMatcher(t *testing.T) {
+	m, err := NewPathMatcher([]string{
+		"/metrics",
+		"/api/",
+		"/static/**",
+		"/debug/pprof/*",
+		"/assets/**/*.js",
+		"re:^/internal/v[0-9]+/",
+		"OPTIONS *",
+		"post /api/v1/callback",
+	})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		method string
+		path   string
+		match  bool
+	}{
+		{"GET", "/metrics", true},
+		{"", "/metrics", true},
+		{"GET", "/metrics/x", false},
+		{"GET", "/static/", true},
+		{"GET", "/static/css/a.css", true},
+		{"GET", "/static", false},
+		// the paths ending with "/" are exact as before.
+		{"GET", "/api/", true},
+		{"GET", "/api/v2/vm", false},
+		{"GET", "/debug/pprof/heap", true},
+		{"GET", "/debug/pprof/heap/x", false},
+		{"GET", "/assets/a/b/c.js", true},
+		{"GET", "/assets/a/b/c.css", false},
+		{"GET", "/internal/v2/sync", true},
+		{"GET", "/internal/sync", false},
+		{"OPTIONS", "/api/v1/vm", true},
+		{"", "/api/v1/vm", false},
+		{"POST", "/api/v1/callback", true},
+		{"GET", "/api/v1/callback", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, m.Match(c.method, c.path), "%s %s", c.method, c.path)
+	}
+
+	m, err = NewPathMatcher([]string{"re:(", "/ok"})
+	assert.Error(t, err)
+	assert.True(t, m.Match("GET", "/ok"))
+
+	var empty *PathMatcher
+	assert.True(t, empty.Empty())
+	assert.False(t, empty.Match("GET", "/"))
+}
+
+func TestIncludedHttpPath(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:      "test",
+		IncludedHttpPath: []string{"/api/**"},
+		ExcludedHttpPath: []string{"OPTIONS *"},
+	})
+	assert.False(t, hub.IsExcludedHttpRequest("GET", "/api/v1/vm"))
+	assert.True(t, hub.IsExcludedHttpRequest("OPTIONS", "/api/v1/vm"))
+	assert.True(t, hub.IsExcludedHttpRequest("GET", "/home"))
+	assert.True(t, hub.IsExcludedHttpPath("/metrics"))
+}
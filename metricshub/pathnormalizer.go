@@ -0,0 +1,133 @@
+package metricshub
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// truncatedSegments is the placeholder of the segments exceeding PathNormalizerConfig.MaxSegments.
+	truncatedSegments = "*"
+)
+
+type (
+	// PathRewriteRule rewrites the parts of the path matching the pattern to the replacement.
+	PathRewriteRule struct {
+		// Pattern is the regular expression to match the path.
+		Pattern string `yaml:"pattern" json:"pattern"`
+		// Replacement is the replacement of the matched parts, it supports
+		// the expansion of regexp.Regexp.ReplaceAllString, e.g. "$1".
+		Replacement string `yaml:"replacement" json:"replacement"`
+	}
+
+	// PathNormalizerConfig is the configuration of PathNormalizer.
+	PathNormalizerConfig struct {
+		// DisableBuiltinRules is the flag to disable the builtin rules, which collapse
+		// UUIDs, emails, numeric IDs and hex hashes in the path segments to
+		// ":uuid", ":email", ":id" and ":hash".
+		// Default is false.
+		// +optional
+		DisableBuiltinRules bool `yaml:"disableBuiltinRules" json:"disableBuiltinRules"`
+		// Rules is the list of user-supplied rewrite rules, they are applied in order
+		// before the builtin rules.
+		// +optional
+		Rules []PathRewriteRule `yaml:"rules" json:"rules"`
+		// MaxSegments is the max number of the path segments, the exceeding segments
+		// are collapsed to "*", e.g. "/a/b/c/d" is normalized to "/a/b/*" if it is 2.
+		// Default is 0, which means no limit.
+		// +optional
+		MaxSegments int `yaml:"maxSegments" json:"maxSegments"`
+	}
+
+	// PathNormalizer normalizes the raw URL paths to low cardinality route paths,
+	// e.g. "/vm/8f3e2b4c-0d7e-4a43-9e8f-5b2b6a1c9d0e/disks/12" to "/vm/:uuid/disks/:id".
+	// It is used when the route template is not available.
+	PathNormalizer struct {
+		rules       []pathRewriter
+		builtin     bool
+		maxSegments int
+	}
+
+	pathRewriter struct {
+		re          *regexp.Regexp
+		replacement string
+	}
+
+	segmentRule struct {
+		re          *regexp.Regexp
+		placeholder string
+	}
+)
+
+var builtinSegmentRules = []segmentRule{
+	{regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`), ":uuid"},
+	{regexp.MustCompile(`^[^@/\s]+@[^@/\s]+\.[^@/\s]+$`), ":email"},
+	{regexp.MustCompile(`^[0-9]+$`), ":id"},
+	{regexp.MustCompile(`^[0-9a-fA-F]{16,}$`), ":hash"},
+}
+
+// NewPathNormalizer creates a PathNormalizer, the nil config means the default config.
+// The invalid rules are skipped and reported in the returned error,
+// the returned PathNormalizer is always usable.
+func NewPathNormalizer(config *PathNormalizerConfig) (*PathNormalizer, error) {
+	if config == nil {
+		config = &PathNormalizerConfig{}
+	}
+
+	n := &PathNormalizer{
+		builtin:     !config.DisableBuiltinRules,
+		maxSegments: config.MaxSegments,
+	}
+
+	var errs []error
+	for _, rule := range config.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid path rewrite rule %q: %v", rule.Pattern, err))
+			continue
+		}
+		n.rules = append(n.rules, pathRewriter{
+			re:          re,
+			replacement: rule.Replacement,
+		})
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// Normalize normalizes the raw URL path.
+func (n *PathNormalizer) Normalize(path string) string {
+	for _, rule := range n.rules {
+		path = rule.re.ReplaceAllString(path, rule.replacement)
+	}
+
+	if !n.builtin && n.maxSegments <= 0 {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	// the first segment is always empty for the absolute path.
+	if n.maxSegments > 0 && len(segments) > n.maxSegments+1 {
+		segments = append(segments[:n.maxSegments+1], truncatedSegments)
+	}
+	if n.builtin {
+		for i, segment := range segments {
+			segments[i] = normalizeSegment(segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func normalizeSegment(segment string) string {
+	if segment == "" || segment[0] == ':' {
+		return segment
+	}
+	for _, rule := range builtinSegmentRules {
+		if rule.re.MatchString(segment) {
+			return rule.placeholder
+		}
+	}
+	return segment
+}
@@ -0,0 +1,38 @@
+package metricshub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathNormalizer(t *testing.T) {
+	n, err := NewPathNormalizer(nil)
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		"/":          "/",
+		"/api/v1/vm": "/api/v1/vm",
+		"/vm/8f3e2b4c-0d7e-4a43-9e8f-5b2b6a1c9d0e/disks/12": "/vm/:uuid/disks/:id",
+		"/users/alice@example.com/orders/":                  "/users/:email/orders/",
+		"/blobs/da39a3ee5e6b4b0d3255bfef95601890afd80709":   "/blobs/:hash",
+		"/vm/:id/cafe": "/vm/:id/cafe",
+	}
+	for path, expected := range cases {
+		assert.Equal(t, expected, n.Normalize(path), path)
+	}
+
+	n, err = NewPathNormalizer(&PathNormalizerConfig{
+		Rules: []PathRewriteRule{
+			{Pattern: `^/tenants/[^/]+`, Replacement: "/tenants/:tenant"},
+			{Pattern: `(`, Replacement: ""},
+		},
+		MaxSegments: 4,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "/tenants/:tenant/vm/:id", n.Normalize("/tenants/acme/vm/12"))
+	assert.Equal(t, "/a/b/c/d/*", n.Normalize("/a/b/c/d/e/f"))
+
+	n, _ = NewPathNormalizer(&PathNormalizerConfig{DisableBuiltinRules: true})
+	assert.Equal(t, "/vm/12", n.Normalize("/vm/12"))
+}
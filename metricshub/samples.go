@@ -0,0 +1,334 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+const (
+	defaultSampleSize           = 10
+	defaultSampleWindow         = 5 * time.Minute
+	defaultSampleNotifyInterval = time.Minute
+)
+
+type (
+	// SampleCaptureConfig is the configuration to capture the slowest and the error
+	// requests of each route, they are served by MetricsHub.DebugHandler.
+	SampleCaptureConfig struct {
+		// Size is the max number of the slowest requests and the error requests kept per route.
+		// Default is 10.
+		// +optional
+		Size int `yaml:"size" json:"size"`
+		// SlowThreshold is the min duration of the requests captured as the slowest ones.
+		// Default is 0, which means all the requests are candidates.
+		// +optional
+		SlowThreshold Duration `yaml:"slowThreshold" json:"slowThreshold"`
+		// Window is the time window of the captured requests, the older ones are dropped.
+		// Default is 5m.
+		// +optional
+		Window Duration `yaml:"window" json:"window"`
+		// NotifyThreshold is the min duration of the requests notified by NotifyResult.
+		// Default is 0, which means no notification.
+		// +optional
+		NotifyThreshold Duration `yaml:"notifyThreshold" json:"notifyThreshold"`
+		// NotifyInterval is the min interval of the notifications of a route.
+		// Default is 1m.
+		// +optional
+		NotifyInterval Duration `yaml:"notifyInterval" json:"notifyInterval"`
+	}
+
+	// RequestSample is a captured request.
+	RequestSample struct {
+		Method string `json:"method"`
+		// Path is the raw path of the request, it is the route path if the raw path is unknown.
+		Path       string `json:"path"`
+		StatusCode int    `json:"status"`
+		// Duration is in milliseconds.
+		Duration uint64 `json:"duration"`
+		ReqSize  uint64 `json:"reqSize"`
+		RespSize uint64 `json:"respSize"`
+		// Time is the time the request started.
+		Time    time.Time `json:"time"`
+		TraceID string    `json:"traceId,omitempty"`
+		Error   string    `json:"error,omitempty"`
+	}
+
+	// RouteSamples is the captured requests of a route.
+	RouteSamples struct {
+		Direction string            `json:"direction"`
+		Target    string            `json:"target,omitempty"`
+		Method    string            `json:"method"`
+		Path      string            `json:"path"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		// Slowest is the slowest requests in the window, sorted by the duration in descending order.
+		Slowest []RequestSample `json:"slowest"`
+		// Errors is the last error requests in the window, sorted by the time in descending order.
+		Errors []RequestSample `json:"errors"`
+	}
+
+	// requestSamples keeps the captured requests of a route.
+	requestSamples struct {
+		mutex        sync.Mutex
+		slowest      []RequestSample
+		errors       []RequestSample
+		lastNotifyAt time.Time
+
+		// slowFloor is checked without locking to skip the requests which are not
+		// slower than the slowest ones, it is nil if the slowest ones are not full.
+		slowFloor atomic.Pointer[sampleFloor]
+	}
+
+	// sampleFloor is the duration of the fastest of the slowest requests,
+	// it is valid until the first of them expires.
+	sampleFloor struct {
+		duration  uint64
+		expiresAt time.Time
+	}
+)
+
+// normalizeSampleCaptureConfig fills the defaults of the config.
+func normalizeSampleCaptureConfig(config *SampleCaptureConfig) {
+	if config.Size <= 0 {
+		config.Size = defaultSampleSize
+	}
+	if config.Window <= 0 {
+		config.Window = Duration(defaultSampleWindow)
+	}
+	if config.NotifyInterval <= 0 {
+		config.NotifyInterval = Duration(defaultSampleNotifyInterval)
+	}
+}
+
+// captureSample captures the request if it is slow or failed, and notifies it if it is very slow.
+func (hub *MetricsHub) captureSample(m *RequestMetric, key httpStatsKey) {
+	config := hub.config.SampleCapture
+	if config == nil {
+		return
+	}
+	slow := m.Duration >= time.Duration(config.SlowThreshold)
+	isErr := m.isErr()
+	notify := config.NotifyThreshold > 0 && m.Duration >= time.Duration(config.NotifyThreshold)
+	if !slow && !isErr && !notify {
+		return
+	}
+
+	value, exists := hub.samples.Load(key)
+	if !exists {
+		value, _ = hub.samples.LoadOrStore(key, &requestSamples{})
+	}
+	samples := value.(*requestSamples)
+
+	now := fasttime.Now()
+	slow = slow && samples.slower(m.Duration, now)
+	if !slow && !isErr && !notify {
+		return
+	}
+
+	sample := RequestSample{
+		Method:     key.Method,
+		Path:       m.RawPath,
+		StatusCode: m.StatusCode,
+		Duration:   uint64(m.Duration.Milliseconds()),
+		ReqSize:    m.ReqSize,
+		RespSize:   m.RespSize,
+		Time:       now.Add(-m.Duration),
+		TraceID:    m.TraceID,
+	}
+	if sample.Path == "" {
+		sample.Path = key.Path
+	}
+	if m.Err != nil {
+		sample.Error = m.Err.Error()
+	} else if m.Cause != "" {
+		sample.Error = m.Cause
+	}
+
+	expiredAt := now.Add(-time.Duration(config.Window))
+	samples.mutex.Lock()
+	if slow {
+		samples.slowest = dropExpiredSamples(samples.slowest, expiredAt)
+		if len(samples.slowest) < config.Size {
+			samples.slowest = append(samples.slowest, sample)
+		} else {
+			fastest := 0
+			for i, s := range samples.slowest {
+				if s.Duration < samples.slowest[fastest].Duration {
+					fastest = i
+				}
+			}
+			if sample.Duration > samples.slowest[fastest].Duration {
+				samples.slowest[fastest] = sample
+			}
+		}
+		samples.updateSlowFloor(config.Size, time.Duration(config.Window))
+	}
+	if isErr {
+		samples.errors = dropExpiredSamples(samples.errors, expiredAt)
+		if len(samples.errors) >= config.Size {
+			samples.errors = slices.Delete(samples.errors, 0, len(samples.errors)-config.Size+1)
+		}
+		samples.errors = append(samples.errors, sample)
+	}
+	if notify && now.Sub(samples.lastNotifyAt) >= time.Duration(config.NotifyInterval) {
+		samples.lastNotifyAt = now
+	} else {
+		notify = false
+	}
+	samples.mutex.Unlock()
+
+	if notify {
+		go hub.notifySlowRequest(key, &sample)
+	}
+}
+
+// slower returns true if the request of the duration may be one of the slowest requests.
+func (s *requestSamples) slower(d time.Duration, now time.Time) bool {
+	floor := s.slowFloor.Load()
+	return floor == nil || uint64(d.Milliseconds()) > floor.duration || !now.Before(floor.expiresAt)
+}
+
+// updateSlowFloor updates the floor of the slowest requests, it must be called with the lock.
+func (s *requestSamples) updateSlowFloor(size int, window time.Duration) {
+	if len(s.slowest) < size {
+		s.slowFloor.Store(nil)
+		return
+	}
+	floor := &sampleFloor{duration: s.slowest[0].Duration, expiresAt: s.slowest[0].Time}
+	for _, sample := range s.slowest[1:] {
+		floor.duration = min(floor.duration, sample.Duration)
+		if sample.Time.Before(floor.expiresAt) {
+			floor.expiresAt = sample.Time
+		}
+	}
+	floor.expiresAt = floor.expiresAt.Add(window)
+	s.slowFloor.Store(floor)
+}
+
+func (hub *MetricsHub) notifySlowRequest(key httpStatsKey, sample *RequestSample) {
+	message := fmt.Sprintf("%s %s took %dms with status %d", sample.Method, sample.Path, sample.Duration, sample.StatusCode)
+	if sample.TraceID != "" {
+		message += ", trace ID: " + sample.TraceID
+	}
+	err := hub.NotifyResult(&Result{
+		UID:       fmt.Sprintf("slow-request-%s-%s-%s", key.Direction, key.Method, key.Path),
+		Title:     "Very slow request",
+		Status:    ResultStatusFailure,
+		Endpoint:  key.Method + " " + key.Path,
+		Message:   message,
+		TimeStamp: sample.Time,
+	})
+	if err != nil {
+		log.Printf("notify slow request failed: %v", err)
+	}
+}
+
+// dropExpiredSamples drops the samples started before the time.
+func dropExpiredSamples(samples []RequestSample, expiredAt time.Time) []RequestSample {
+	return slices.DeleteFunc(samples, func(s RequestSample) bool {
+		return s.Time.Before(expiredAt)
+	})
+}
+
+// Samples returns the captured requests of the routes in the window, filtered by the query,
+// the sort and limit fields of the query are ignored. It returns nil if the capture is disabled.
+func (hub *MetricsHub) Samples(query *StatsQuery) []*RouteSamples {
+	config := hub.config.SampleCapture
+	if config == nil {
+		return nil
+	}
+	if query == nil {
+		query = &StatsQuery{}
+	}
+
+	expiredAt := fasttime.Now().Add(-time.Duration(config.Window))
+	result := []*RouteSamples{}
+	hub.samples.Range(func(k, v any) bool {
+		key, samples := k.(httpStatsKey), v.(*requestSamples)
+		if query.Direction != "" && query.Direction != key.Direction {
+			return true
+		}
+		if query.Method != "" && !strings.EqualFold(query.Method, key.Method) {
+			return true
+		}
+		if !strings.HasPrefix(key.Path, query.PathPrefix) {
+			return true
+		}
+
+		samples.mutex.Lock()
+		samples.slowest = dropExpiredSamples(samples.slowest, expiredAt)
+		samples.errors = dropExpiredSamples(samples.errors, expiredAt)
+		rs := &RouteSamples{
+			Direction: key.Direction,
+			Target:    key.Target,
+			Method:    key.Method,
+			Path:      key.Path,
+			Labels:    key.extraLabels(),
+			Slowest:   slices.Clone(samples.slowest),
+			Errors:    slices.Clone(samples.errors),
+		}
+		samples.mutex.Unlock()
+		if len(rs.Slowest) == 0 && len(rs.Errors) == 0 {
+			return true
+		}
+
+		sort.SliceStable(rs.Slowest, func(i, j int) bool {
+			return rs.Slowest[i].Duration > rs.Slowest[j].Duration
+		})
+		slices.Reverse(rs.Errors)
+		result = append(result, rs)
+		return true
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		if result[i].Method != result[j].Method {
+			return result[i].Method < result[j].Method
+		}
+		return result[i].Direction > result[j].Direction
+	})
+	return result
+}
+
+// DebugHandler returns an HTTP handler serving the captured slowest and error requests
+// of the routes in JSON, see MetricsHubConfig.SampleCapture. It supports the query
+// parameters direction, prefix and method, which are the same as StatsHandler.
+func (hub *MetricsHub) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if hub.config.SampleCapture == nil {
+			http.Error(w, "sample capture is disabled", http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+		result := hub.Samples(&StatsQuery{
+			Direction:  q.Get("direction"),
+			PathPrefix: q.Get("prefix"),
+			Method:     q.Get("method"),
+		})
+
+		body, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+	})
+}
@@ -0,0 +1,135 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleCapture(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+		SampleCapture: &SampleCaptureConfig{
+			Size:          2,
+			SlowThreshold: Duration(100 * time.Millisecond),
+		},
+	})
+	for _, d := range []time.Duration{50, 300, 200, 100, 400} {
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{
+			StatusCode: 200,
+			Duration:   d * time.Millisecond,
+			RawPath:    "/vm/1",
+		}, "GET", "/vm/:id")
+	}
+	for i := 500; i < 503; i++ {
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{
+			StatusCode: i,
+			Err:        errors.New("boom"),
+			TraceID:    "abc",
+		}, "POST", "/vm")
+	}
+
+	result := hub.Samples(nil)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "/vm", result[0].Path)
+	assert.Empty(t, result[0].Slowest)
+	assert.Len(t, result[0].Errors, 2)
+	assert.Equal(t, 502, result[0].Errors[0].StatusCode)
+	assert.Equal(t, 501, result[0].Errors[1].StatusCode)
+	assert.Equal(t, "boom", result[0].Errors[0].Error)
+	assert.Equal(t, "abc", result[0].Errors[0].TraceID)
+	assert.Equal(t, "/vm", result[0].Errors[0].Path)
+
+	assert.Equal(t, "/vm/:id", result[1].Path)
+	assert.Empty(t, result[1].Errors)
+	assert.Len(t, result[1].Slowest, 2)
+	assert.Equal(t, uint64(400), result[1].Slowest[0].Duration)
+	assert.Equal(t, uint64(300), result[1].Slowest[1].Duration)
+	assert.Equal(t, "/vm/1", result[1].Slowest[0].Path)
+
+	w := httptest.NewRecorder()
+	hub.DebugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug?method=post", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body []*RouteSamples
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body, 1)
+	assert.Equal(t, "POST", body[0].Method)
+}
+
+func TestSampleCaptureWindow(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:   "test",
+		SampleCapture: &SampleCaptureConfig{Window: Duration(50 * time.Millisecond)},
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 404}, "GET", "/vm")
+	assert.Len(t, hub.Samples(nil), 1)
+	time.Sleep(60 * time.Millisecond)
+	assert.Empty(t, hub.Samples(nil))
+
+	hub = NewMetricsHub(&MetricsHubConfig{ServiceName: "test"})
+	w := httptest.NewRecorder()
+	hub.DebugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSampleCaptureSlowFloor(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:   "test",
+		SampleCapture: &SampleCaptureConfig{Size: 2, Window: Duration(100 * time.Millisecond)},
+	})
+	update := func(d time.Duration) {
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: d}, "GET", "/vm")
+	}
+	update(20 * time.Millisecond)
+	update(30 * time.Millisecond)
+	value, _ := hub.samples.Load(httpStatsKey{Direction: DirectionServer, Method: "GET", Path: "/vm"})
+	samples := value.(*requestSamples)
+	assert.Equal(t, uint64(20), samples.slowFloor.Load().duration)
+	assert.False(t, samples.slower(10*time.Millisecond, time.Now()))
+	assert.True(t, samples.slower(25*time.Millisecond, time.Now()))
+
+	// the faster requests are captured again when the slowest ones expire.
+	time.Sleep(100 * time.Millisecond)
+	update(5 * time.Millisecond)
+	result := hub.Samples(nil)
+	assert.Len(t, result, 1)
+	assert.Len(t, result[0].Slowest, 1)
+	assert.Equal(t, uint64(5), result[0].Slowest[0].Duration)
+}
+
+func TestSampleCaptureNotify(t *testing.T) {
+	notified := make(chan string, 2)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		notified <- msg["text"].(string)
+	}))
+	defer slack.Close()
+
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:     "test",
+		SlackWebhookURL: slack.URL,
+		SampleCapture:   &SampleCaptureConfig{NotifyThreshold: Duration(time.Second)},
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 10 * time.Millisecond}, "GET", "/vm")
+	for i := 0; i < 2; i++ {
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 2 * time.Second, RawPath: "/vm"}, "GET", "/vm")
+	}
+
+	select {
+	case text := <-notified:
+		assert.Contains(t, text, "GET /vm took 2000ms with status 200")
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+	select {
+	case <-notified:
+		t.Fatal("the notifications of a route should be rate limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
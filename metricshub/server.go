@@ -0,0 +1,202 @@
+package metricshub
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// connStateTracker tracks the states of the server connections by http.Server.ConnState,
+	// and the TLS handshakes by the hooks of http.Server.TLSConfig.
+	connStateTracker struct {
+		metrics *httpRequestMetrics
+		next    func(net.Conn, http.ConnState)
+
+		mutex sync.Mutex
+		// conns is keyed by the underlying connections of the TLS connections,
+		// which are the connections known by the TLS hooks.
+		conns map[net.Conn]*connStateInfo
+	}
+
+	connStateInfo struct {
+		state    http.ConnState
+		openAt   time.Time
+		requests int
+
+		handshakeAt     time.Time
+		handshakeDoneAt time.Time
+	}
+
+	// instrumentedListener counts the accept errors.
+	instrumentedListener struct {
+		net.Listener
+		metrics *httpRequestMetrics
+	}
+)
+
+// InstrumentServer hooks the ConnState of the server to collect the server connection
+// metrics, i.e. the number of the new, active and idle connections, the transitions into
+// the new, active, idle, hijacked and closed states, the lifetime of the connections and
+// the number of the requests served by them. The existing ConnState hook is still called.
+//
+// The TLS handshakes are observed by the TLS version and the negotiated protocol, i.e. h1
+// or h2, and timed from the client hello by the GetConfigForClient hook installed into a
+// copy of the TLSConfig of the server, which is used by ServeTLS and ListenAndServeTLS.
+// If the server is served by Serve, create the TLS listener by the TLSConfig of the server.
+//
+// It must be called before the server is started, use InstrumentListener to collect the
+// accept errors.
+func (hub *MetricsHub) InstrumentServer(server *http.Server) {
+	t := &connStateTracker{
+		metrics: hub.httpMetrics,
+		next:    server.ConnState,
+		conns:   make(map[net.Conn]*connStateInfo),
+	}
+	server.ConnState = t.connState
+	server.TLSConfig = t.instrumentTLS(server.TLSConfig)
+}
+
+// InstrumentListener wraps the listener to count the accept errors.
+func (hub *MetricsHub) InstrumentListener(ln net.Listener) net.Listener {
+	return &instrumentedListener{
+		Listener: ln,
+		metrics:  hub.httpMetrics,
+	}
+}
+
+// instrumentTLS returns a copy of the config with the GetConfigForClient hook, which
+// records the start of the handshake, the existing hook is still called.
+func (t *connStateTracker) instrumentTLS(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	next := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		t.startHandshake(hello)
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	return config
+}
+
+// startHandshake records the start of the handshake, and the end of it when the
+// handshake context is done.
+func (t *connStateTracker) startHandshake(hello *tls.ClientHelloInfo) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	info, exists := t.conns[hello.Conn]
+	if !exists {
+		return
+	}
+	info.handshakeAt = fasttime.Now()
+	context.AfterFunc(hello.Context(), func() {
+		t.mutex.Lock()
+		info.handshakeDoneAt = fasttime.Now()
+		t.mutex.Unlock()
+	})
+}
+
+func (t *connStateTracker) connState(conn net.Conn, state http.ConnState) {
+	t.update(conn, state)
+	if t.next != nil {
+		t.next(conn, state)
+	}
+}
+
+func (t *connStateTracker) update(conn net.Conn, state http.ConnState) {
+	t.metrics.ServerConnectionsTotal.With(prometheus.Labels{"state": state.String()}).Inc()
+
+	key := conn
+	tlsConn, _ := conn.(*tls.Conn)
+	if tlsConn != nil {
+		key = tlsConn.NetConn()
+	}
+
+	t.mutex.Lock()
+	info, exists := t.conns[key]
+	if !exists {
+		info = &connStateInfo{openAt: fasttime.Now()}
+		t.conns[key] = info
+	} else {
+		t.metrics.ServerConnections.With(prometheus.Labels{"state": info.state.String()}).Dec()
+	}
+	// The handshake is done by http.Server before the connection leaves the new state.
+	handshaked := tlsConn != nil && info.state == http.StateNew && state != http.StateNew
+	handshakeAt, handshakeDoneAt := info.handshakeAt, info.handshakeDoneAt
+	info.state = state
+	if state == http.StateActive {
+		info.requests++
+	}
+	finished := state == http.StateHijacked || state == http.StateClosed
+	if finished {
+		delete(t.conns, key)
+	}
+	t.mutex.Unlock()
+
+	if handshaked {
+		t.observeHandshake(tlsConn, handshakeAt, handshakeDoneAt)
+	}
+	if finished {
+		t.metrics.ServerConnectionDuration.Observe(fasttime.Since(info.openAt).Seconds())
+		t.metrics.ServerConnectionRequests.Observe(float64(info.requests))
+		return
+	}
+	t.metrics.ServerConnections.With(prometheus.Labels{"state": state.String()}).Inc()
+}
+
+// observeHandshake observes the handshake of the connection, it is failed if the
+// connection is closed before the handshake is completed. The duration is unknown
+// if the handshake is not started by the hook, e.g. the TLS listener is created by
+// another config.
+func (t *connStateTracker) observeHandshake(conn *tls.Conn, startAt, doneAt time.Time) {
+	state := conn.ConnectionState()
+	if !state.HandshakeComplete {
+		t.metrics.ServerTLSHandshakeFailures.Inc()
+		return
+	}
+	labels := prometheus.Labels{
+		"version":  tls.VersionName(state.Version),
+		"protocol": tlsProtocol(state.NegotiatedProtocol),
+	}
+	t.metrics.ServerTLSHandshakes.With(labels).Inc()
+	if startAt.IsZero() {
+		return
+	}
+	// The end may not be recorded yet, since the hook of the done context is
+	// called in another goroutine.
+	if doneAt.IsZero() {
+		doneAt = fasttime.Now()
+	}
+	t.metrics.ServerTLSHandshakeDuration.With(labels).Observe(float64(doneAt.Sub(startAt).Milliseconds()))
+}
+
+// Accept implements net.Listener.
+func (l *instrumentedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		l.metrics.AcceptErrors.Inc()
+	}
+	return conn, err
+}
+
+// tlsProtocol returns the http protocol of the negotiated application protocol.
+func tlsProtocol(proto string) string {
+	switch proto {
+	case "", "http/1.1", "http/1.0":
+		return "h1"
+	default:
+		return proto
+	}
+}
@@ -0,0 +1,127 @@
+package metricshub
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentServer(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var hooked atomic.Int32
+	srv.Config.ConnState = func(net.Conn, http.ConnState) { hooked.Add(1) }
+	hub.InstrumentServer(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	client := srv.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		assert.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	client.CloseIdleConnections()
+
+	assert.Eventually(t, func() bool {
+		return counterValue(t, hub, "server_connections_total", "state", "closed") == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(1), counterValue(t, hub, "server_connections_total", "state", "new"))
+	assert.Equal(t, float64(2), counterValue(t, hub, "server_connections_total", "state", "active"))
+	for _, m := range gatherMetrics(t, hub, "server_connections") {
+		assert.Equal(t, float64(0), m.GetGauge().GetValue(), labelValue(m, "state"))
+	}
+	requests := gatherMetrics(t, hub, "server_connection_requests")
+	assert.Len(t, requests, 1)
+	assert.Equal(t, float64(2), requests[0].GetHistogram().GetSampleSum())
+	// new, active, idle, active, idle and closed.
+	assert.Equal(t, int32(6), hooked.Load())
+}
+
+type errListener struct {
+	net.Listener
+	err error
+}
+
+func (l *errListener) Accept() (net.Conn, error) {
+	return nil, l.err
+}
+
+func TestInstrumentServerTLS(t *testing.T) {
+	// borrow the certificate and the client of httptest.
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	serves := map[string]func(srv *http.Server, ln net.Listener) error{
+		"ServeTLS": func(srv *http.Server, ln net.Listener) error {
+			return srv.ServeTLS(ln, "", "")
+		},
+		"Serve": func(srv *http.Server, ln net.Listener) error {
+			return srv.Serve(tls.NewListener(ln, srv.TLSConfig))
+		},
+	}
+	for name, serve := range serves {
+		t.Run(name, func(t *testing.T) {
+			hub := NewMetricsHub(&MetricsHubConfig{
+				ServiceName: "test",
+			})
+			srv := &http.Server{
+				Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				TLSConfig: &tls.Config{Certificates: ts.TLS.Certificates},
+				ErrorLog:  log.New(io.Discard, "", 0),
+			}
+			hub.InstrumentServer(srv)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			go serve(srv, ln)
+			defer srv.Close()
+
+			resp, err := ts.Client().Get("https://" + ln.Addr().String())
+			assert.NoError(t, err)
+			resp.Body.Close()
+
+			// a plain text request fails the handshake.
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			assert.NoError(t, err)
+			conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+			io.Copy(io.Discard, conn)
+			conn.Close()
+
+			assert.Eventually(t, func() bool {
+				return counterValue(t, hub, "server_tls_handshake_failures_total", "", "") == 1
+			}, time.Second, 10*time.Millisecond)
+			handshakes := gatherMetrics(t, hub, "server_tls_handshakes_total")
+			assert.Len(t, handshakes, 1)
+			assert.Equal(t, "TLS 1.3", labelValue(handshakes[0], "version"))
+			assert.Equal(t, "h1", labelValue(handshakes[0], "protocol"))
+			durations := gatherMetrics(t, hub, "server_tls_handshake_duration")
+			assert.Len(t, durations, 1)
+			assert.Equal(t, uint64(1), durations[0].GetHistogram().GetSampleCount())
+		})
+	}
+}
+
+func TestInstrumentListener(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	ln := hub.InstrumentListener(&errListener{err: errors.New("too many open files")})
+	_, err := ln.Accept()
+	assert.Error(t, err)
+	ln = hub.InstrumentListener(&errListener{err: net.ErrClosed})
+	_, err = ln.Accept()
+	assert.Error(t, err)
+	assert.Equal(t, float64(1), counterValue(t, hub, "server_accept_errors_total", "", ""))
+}
@@ -0,0 +1,354 @@
+package metricshub
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultSLOPeriod    = 30 * 24 * time.Hour
+	defaultSLOMinEvents = 10
+)
+
+type (
+	// SLOConfig is the service level objective of the inbound http requests.
+	// A request is a good event if it is not a server error and, for a latency SLO,
+	// it is served within Latency.
+	SLOConfig struct {
+		// Name is the unique name of the SLO, it is the slo label of the metrics.
+		Name string `yaml:"name" json:"name"`
+		// Route is the pattern of the routes, it is the same as MetricsHubConfig.ExcludedHttpPath,
+		// e.g. "POST /vm", "/api/v1/**".
+		// Default is empty, which means all routes.
+		// +optional
+		Route string `yaml:"route" json:"route"`
+		// Objective is the target ratio of the good events, e.g. 0.999.
+		Objective float64 `yaml:"objective" json:"objective"`
+		// Latency is the max duration of a good event.
+		// Default is 0, which means it is an availability SLO.
+		// +optional
+		Latency Duration `yaml:"latency" json:"latency"`
+		// Period is the period of the error budget, it is rounded up to hours.
+		// Default is 30 days.
+		// +optional
+		Period Duration `yaml:"period" json:"period"`
+		// MinEvents is the min number of the events in both windows of a burn rate alert
+		// to fire it, so a few failed requests of an idle service don't fire the alerts.
+		// Default is 10.
+		// +optional
+		MinEvents uint64 `yaml:"minEvents" json:"minEvents"`
+	}
+
+	// SLOStatus is the status of an SLO.
+	SLOStatus struct {
+		Name      string  `json:"name"`
+		Route     string  `json:"route,omitempty"`
+		Objective float64 `json:"objective"`
+		// GoodEvents and TotalEvents are counted in the period.
+		GoodEvents  uint64 `json:"goodEvents"`
+		TotalEvents uint64 `json:"totalEvents"`
+		// ErrorBudgetRemaining is the ratio of the error budget left in the period,
+		// it is negative if the budget is exhausted.
+		ErrorBudgetRemaining float64 `json:"errorBudgetRemaining"`
+		// BurnRates is the error rate divided by the error budget rate (1 - Objective)
+		// in the windows, the key is the window, e.g. "5m", "1h".
+		BurnRates map[string]float64 `json:"burnRates"`
+		// Alerts is the names of the firing burn rate alerts, e.g. "fast_burn".
+		Alerts []string `json:"alerts,omitempty"`
+	}
+
+	// burnRateAlert fires if the burn rates of both the long and the short windows
+	// exceed the threshold, see https://sre.google/workbook/alerting-on-slos/.
+	burnRateAlert struct {
+		name      string
+		long      time.Duration
+		short     time.Duration
+		threshold float64
+	}
+
+	// sloTracker tracks the events of an SLO. The events are counted every tick,
+	// ticks is a ring buffer of the recent ticks covering the burn rate windows,
+	// and hours is a ring buffer of the hours covering the period.
+	sloTracker struct {
+		mutex sync.RWMutex
+
+		config  SLOConfig
+		matcher *PathMatcher
+
+		tickGood  uint64
+		tickTotal uint64
+
+		ticks     []sloSlot
+		tickIdx   int
+		hours     []sloSlot
+		hourIdx   int
+		hourTicks int
+
+		firing map[string]bool
+		status *SLOStatus
+	}
+
+	sloSlot struct {
+		good  uint64
+		total uint64
+	}
+)
+
+var (
+	// sloBurnRateWindows are the windows of the burn rates.
+	sloBurnRateWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+	// sloBurnRateAlerts are the multi-window burn rate alerts, the fast burn consumes
+	// 2% of the 30 days budget in an hour, and the slow burn consumes 5% in 6 hours.
+	sloBurnRateAlerts = []burnRateAlert{
+		{name: "fast_burn", long: time.Hour, short: 5 * time.Minute, threshold: 14.4},
+		{name: "slow_burn", long: 6 * time.Hour, short: 30 * time.Minute, threshold: 6},
+	}
+)
+
+// newSLOTrackers creates the trackers of the SLOs, the invalid SLOs are skipped.
+func (hub *MetricsHub) newSLOTrackers() []*sloTracker {
+	var trackers []*sloTracker
+	var names []string
+	for _, config := range hub.config.SLOs {
+		switch {
+		case config.Name == "":
+			log.Printf("invalid slo: empty name")
+			continue
+		case slices.Contains(names, config.Name):
+			log.Printf("invalid slo %s: duplicated name", config.Name)
+			continue
+		case config.Objective <= 0 || config.Objective >= 1:
+			log.Printf("invalid slo %s: objective %v is not in (0, 1)", config.Name, config.Objective)
+			continue
+		}
+
+		t := &sloTracker{
+			config: config,
+			firing: make(map[string]bool),
+		}
+		if config.Route != "" {
+			matcher, err := NewPathMatcher([]string{config.Route})
+			if err != nil {
+				log.Printf("invalid slo %s: %v", config.Name, err)
+				continue
+			}
+			t.matcher = matcher
+		}
+		if t.config.Period <= 0 {
+			t.config.Period = Duration(defaultSLOPeriod)
+		}
+		if t.config.MinEvents == 0 {
+			t.config.MinEvents = defaultSLOMinEvents
+		}
+		t.ticks = make([]sloSlot, windowSlots(slices.Max(sloBurnRateWindows)))
+		t.hours = make([]sloSlot, max(int((time.Duration(t.config.Period)+time.Hour-1)/time.Hour), 1))
+
+		names = append(names, config.Name)
+		trackers = append(trackers, t)
+	}
+	return trackers
+}
+
+// match returns true if the route is of the SLO.
+func (t *sloTracker) match(method, path string) bool {
+	return t.matcher == nil || t.matcher.Match(method, path)
+}
+
+// good returns true if the request is a good event of the SLO.
+func (t *sloTracker) good(m *RequestMetric) bool {
+	if m.errorClass() == ErrorClassServer {
+		return false
+	}
+	return t.config.Latency <= 0 || m.Duration <= time.Duration(t.config.Latency)
+}
+
+// observe counts the request.
+func (t *sloTracker) observe(m *RequestMetric) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	good := t.good(m)
+	if good {
+		atomic.AddUint64(&t.tickGood, 1)
+	}
+	atomic.AddUint64(&t.tickTotal, 1)
+	return good
+}
+
+// tick pushes the events of the last tick into the ring buffers, and returns the
+// status and the alerts whose state is changed.
+func (t *sloTracker) tick() (*SLOStatus, map[string]bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	slot := sloSlot{good: t.tickGood, total: t.tickTotal}
+	t.tickGood, t.tickTotal = 0, 0
+
+	t.ticks[t.tickIdx] = slot
+	t.tickIdx = (t.tickIdx + 1) % len(t.ticks)
+
+	t.hours[t.hourIdx].good += slot.good
+	t.hours[t.hourIdx].total += slot.total
+	t.hourTicks++
+	if t.hourTicks >= windowSlots(time.Hour) {
+		t.hourIdx = (t.hourIdx + 1) % len(t.hours)
+		t.hours[t.hourIdx] = sloSlot{}
+		t.hourTicks = 0
+	}
+
+	var period sloSlot
+	for _, s := range t.hours {
+		period.good += s.good
+		period.total += s.total
+	}
+
+	status := &SLOStatus{
+		Name:                 t.config.Name,
+		Route:                t.config.Route,
+		Objective:            t.config.Objective,
+		GoodEvents:           period.good,
+		TotalEvents:          period.total,
+		ErrorBudgetRemaining: 1 - t.burnRate(period),
+		BurnRates:            make(map[string]float64, len(sloBurnRateWindows)),
+	}
+	for _, w := range sloBurnRateWindows {
+		status.BurnRates[FormatWindow(w)] = t.burnRate(t.window(w))
+	}
+
+	changed := make(map[string]bool)
+	for _, alert := range sloBurnRateAlerts {
+		long, short := t.window(alert.long), t.window(alert.short)
+		firing := long.total >= t.config.MinEvents && short.total >= t.config.MinEvents &&
+			t.burnRate(long) > alert.threshold && t.burnRate(short) > alert.threshold
+		if firing != t.firing[alert.name] {
+			t.firing[alert.name] = firing
+			changed[alert.name] = firing
+		}
+		if firing {
+			status.Alerts = append(status.Alerts, alert.name)
+		}
+	}
+
+	t.status = status
+	return status, changed
+}
+
+// window returns the events of the recent ticks in the window.
+func (t *sloTracker) window(w time.Duration) sloSlot {
+	var agg sloSlot
+	n := min(windowSlots(w), len(t.ticks))
+	for i := 1; i <= n; i++ {
+		s := t.ticks[(t.tickIdx-i+len(t.ticks))%len(t.ticks)]
+		agg.good += s.good
+		agg.total += s.total
+	}
+	return agg
+}
+
+// burnRate returns the error rate of the events divided by the error budget rate,
+// it is 0 if there is no event.
+func (t *sloTracker) burnRate(s sloSlot) float64 {
+	if s.total == 0 {
+		return 0
+	}
+	errorRate := float64(s.total-s.good) / float64(s.total)
+	return errorRate / (1 - t.config.Objective)
+}
+
+// observeSLOs counts the inbound request into the SLOs of its route.
+func (hub *MetricsHub) observeSLOs(m *RequestMetric, key httpStatsKey) {
+	if len(hub.slos) == 0 || key.Direction != DirectionServer {
+		return
+	}
+
+	routeKey := httpStatsKey{Direction: key.Direction, Method: key.Method, Path: key.Path}
+	trackers, ok := hub.sloRoutes.Load(routeKey)
+	if !ok {
+		var matched []*sloTracker
+		for _, t := range hub.slos {
+			if t.match(key.Method, key.Path) {
+				matched = append(matched, t)
+			}
+		}
+		trackers, _ = hub.sloRoutes.LoadOrStore(routeKey, matched)
+	}
+
+	for _, t := range trackers.([]*sloTracker) {
+		labels := prometheus.Labels{"slo": t.config.Name}
+		if t.observe(m) {
+			hub.httpMetrics.SLOGoodEvents.With(labels).Inc()
+		}
+		hub.httpMetrics.SLOEvents.With(labels).Inc()
+	}
+}
+
+// updateSLOs updates the status of the SLOs, exports them to prometheus,
+// and notifies the changes of the burn rate alerts.
+func (hub *MetricsHub) updateSLOs() {
+	m := hub.httpMetrics
+	for _, t := range hub.slos {
+		status, changed := t.tick()
+
+		labels := prometheus.Labels{"slo": status.Name}
+		m.SLOObjective.With(labels).Set(status.Objective)
+		m.SLOErrorBudgetRemaining.With(labels).Set(status.ErrorBudgetRemaining)
+		for window, rate := range status.BurnRates {
+			m.SLOBurnRate.With(prometheus.Labels{"slo": status.Name, "window": window}).Set(rate)
+		}
+		for _, alert := range sloBurnRateAlerts {
+			value := 0.0
+			if slices.Contains(status.Alerts, alert.name) {
+				value = 1
+			}
+			m.SLOBurnRateAlerts.With(prometheus.Labels{"slo": status.Name, "alert": alert.name}).Set(value)
+		}
+
+		for _, alert := range sloBurnRateAlerts {
+			if firing, ok := changed[alert.name]; ok {
+				hub.notifySLOAlert(status, alert, firing)
+			}
+		}
+	}
+}
+
+func (hub *MetricsHub) notifySLOAlert(status *SLOStatus, alert burnRateAlert, firing bool) {
+	long, short := FormatWindow(alert.long), FormatWindow(alert.short)
+	message := fmt.Sprintf("SLO %s (%g) burn rate is %.2f over %s and %.2f over %s, threshold %g, error budget remaining %.2f%%",
+		status.Name, status.Objective, status.BurnRates[long], long, status.BurnRates[short], short,
+		alert.threshold, status.ErrorBudgetRemaining*100)
+	result := &Result{
+		UID:       fmt.Sprintf("slo-%s-%s", status.Name, alert.name),
+		Title:     "SLO error budget is burning too fast",
+		Status:    ResultStatusFailure,
+		Endpoint:  status.Route,
+		Message:   message,
+		TimeStamp: fasttime.Now(),
+	}
+	if !firing {
+		result.Title = "SLO error budget burn rate is resolved"
+		result.Status = ResultStatusSuccess
+	}
+	hub.notifyInOrder(result)
+}
+
+// SLOStatus returns the status of the SLOs updated in the last tick.
+func (hub *MetricsHub) SLOStatus() []*SLOStatus {
+	result := make([]*SLOStatus, 0, len(hub.slos))
+	for _, t := range hub.slos {
+		t.mutex.RLock()
+		status := t.status
+		t.mutex.RUnlock()
+		if status != nil {
+			result = append(result, status)
+		}
+	}
+	return result
+}
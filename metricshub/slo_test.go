@@ -0,0 +1,154 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOTracker(t *testing.T) {
+	hub := &MetricsHub{config: &MetricsHubConfig{SLOs: []SLOConfig{
+		{Name: "create-vm", Route: "POST /vm", Objective: 0.99, Latency: Duration(500 * time.Millisecond), Period: Duration(90 * time.Minute), MinEvents: 4},
+		{Name: "create-vm", Objective: 0.99},
+		{Name: "invalid", Objective: 1},
+		{Name: "bad-route", Route: "re:(", Objective: 0.9},
+	}}}
+	trackers := hub.newSLOTrackers()
+	assert.Len(t, trackers, 1)
+	tracker := trackers[0]
+	assert.Len(t, tracker.hours, 2)
+	assert.True(t, tracker.match("POST", "/vm"))
+	assert.False(t, tracker.match("GET", "/vm"))
+
+	tracker.observe(&RequestMetric{StatusCode: 200, Duration: 100 * time.Millisecond})
+	tracker.observe(&RequestMetric{StatusCode: 404, Duration: 100 * time.Millisecond})
+	tracker.observe(&RequestMetric{StatusCode: 200, Duration: time.Second})
+	tracker.observe(&RequestMetric{StatusCode: 503, Duration: 100 * time.Millisecond})
+	status, changed := tracker.tick()
+	assert.Equal(t, uint64(2), status.GoodEvents)
+	assert.Equal(t, uint64(4), status.TotalEvents)
+	assert.InDelta(t, -49, status.ErrorBudgetRemaining, 1e-9)
+	assert.InDelta(t, 50, status.BurnRates["5m"], 1e-9)
+	assert.InDelta(t, 50, status.BurnRates["6h"], 1e-9)
+	assert.Equal(t, []string{"fast_burn", "slow_burn"}, status.Alerts)
+	assert.Equal(t, map[string]bool{"fast_burn": true, "slow_burn": true}, changed)
+
+	// the alerts are resolved when the short windows recover.
+	for i := 0; i < windowSlots(5*time.Minute); i++ {
+		status, changed = tracker.tick()
+	}
+	assert.Equal(t, float64(0), status.BurnRates["5m"])
+	assert.InDelta(t, 50, status.BurnRates["30m"], 1e-9)
+	assert.Equal(t, []string{"slow_burn"}, status.Alerts)
+	assert.Equal(t, map[string]bool{"fast_burn": false}, changed)
+
+	// the events out of the period are dropped.
+	for i := 0; i < windowSlots(2*time.Hour); i++ {
+		status, _ = tracker.tick()
+	}
+	assert.Equal(t, uint64(0), status.TotalEvents)
+	assert.Equal(t, float64(1), status.ErrorBudgetRemaining)
+	assert.Empty(t, status.Alerts)
+}
+
+func TestSLOTrackerMinEvents(t *testing.T) {
+	hub := &MetricsHub{config: &MetricsHubConfig{SLOs: []SLOConfig{
+		{Name: "availability", Objective: 0.999},
+	}}}
+	tracker := hub.newSLOTrackers()[0]
+	assert.Equal(t, uint64(defaultSLOMinEvents), tracker.config.MinEvents)
+
+	// a failed request of an idle service doesn't fire the alerts.
+	tracker.observe(&RequestMetric{StatusCode: 503})
+	status, changed := tracker.tick()
+	assert.InDelta(t, 1000, status.BurnRates["1h"], 1e-9)
+	assert.Empty(t, status.Alerts)
+	assert.Empty(t, changed)
+
+	for i := 0; i < defaultSLOMinEvents; i++ {
+		tracker.observe(&RequestMetric{StatusCode: 503})
+	}
+	status, changed = tracker.tick()
+	assert.Equal(t, []string{"fast_burn", "slow_burn"}, status.Alerts)
+	assert.Equal(t, map[string]bool{"fast_burn": true, "slow_burn": true}, changed)
+}
+
+func TestSLONotify(t *testing.T) {
+	notified := make(chan string, 4)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		notified <- msg["text"].(string)
+	}))
+	defer slack.Close()
+
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName:     "test",
+		SlackWebhookURL: slack.URL,
+		SLOs: []SLOConfig{
+			{Name: "availability", Objective: 0.999},
+			{Name: "create-vm", Route: "POST /vm", Objective: 0.99, Latency: Duration(500 * time.Millisecond), MinEvents: 1},
+		},
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 100 * time.Millisecond}, "GET", "/vm")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: time.Second}, "POST", "/vm")
+	hub.updateHTTPStatus()
+
+	var texts []string
+	for i := 0; i < 2; i++ {
+		select {
+		case text := <-notified:
+			texts = append(texts, text)
+		case <-time.After(time.Second):
+			t.Fatal("no notification")
+		}
+	}
+	assert.Contains(t, strings.Join(texts, "\n"), "SLO create-vm (0.99) burn rate is 100.00 over 1h")
+
+	assert.Equal(t, float64(2), counterValue(t, hub, "slo_events_total", "slo", "availability"))
+	assert.Equal(t, float64(1), counterValue(t, hub, "slo_events_total", "slo", "create-vm"))
+	assert.Equal(t, float64(0), counterValue(t, hub, "slo_good_events_total", "slo", "create-vm"))
+	alerts := gatherMetrics(t, hub, "slo_burn_rate_alert")
+	assert.Len(t, alerts, 4)
+	for _, m := range alerts {
+		assert.Equal(t, labelValue(m, "slo") == "create-vm", m.GetGauge().GetValue() == 1)
+	}
+	assert.Len(t, gatherMetrics(t, hub, "slo_burn_rate"), 2*len(sloBurnRateWindows))
+
+	for i := 0; i < 10000; i++ {
+		hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 100 * time.Millisecond}, "POST", "/vm")
+	}
+	hub.updateHTTPStatus()
+	for i := 0; i < 2; i++ {
+		select {
+		case text := <-notified:
+			assert.Contains(t, text, "resolved")
+		case <-time.After(time.Second):
+			t.Fatal("no resolve notification")
+		}
+	}
+
+	status := hub.SLOStatus()
+	assert.Len(t, status, 2)
+	assert.Equal(t, uint64(10001), status[1].TotalEvents)
+	assert.Empty(t, status[1].Alerts)
+}
+
+func TestSLOConfigJSON(t *testing.T) {
+	var config SLOConfig
+	assert.NoError(t, json.Unmarshal([]byte(`{"name": "create-vm", "objective": 0.99, "latency": "300ms", "period": 86400000000000}`), &config))
+	assert.Equal(t, Duration(300*time.Millisecond), config.Latency)
+	assert.Equal(t, Duration(24*time.Hour), config.Period)
+
+	b, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"latency":"300ms","period":"24h0m0s"`)
+	var decoded SLOConfig
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, config, decoded)
+}
@@ -0,0 +1,252 @@
+package metricshub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// RouteStatus is the status of a route served by the stats API.
+	RouteStatus struct {
+		Direction string `json:"direction"`
+		Target    string `json:"target,omitempty"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		// Labels is the extra labels of the route, see MetricsHubConfig.HTTPExtraLabels.
+		Labels map[string]string `json:"labels,omitempty"`
+		*Status
+
+		// extra is the encoded Labels to sort the routes.
+		extra string
+	}
+
+	// StatsQuery is the query of the stats API.
+	StatsQuery struct {
+		// Direction filters the routes by the direction, DirectionServer or DirectionClient.
+		Direction string
+		// PathPrefix filters the routes by the path prefix.
+		PathPrefix string
+		// Method filters the routes by the method, case-insensitive.
+		Method string
+		// SortBy is the json name of the numeric field in StatisticsMetric, e.g. p99.
+		SortBy string
+		// Ascending sorts the routes in ascending order, default is descending.
+		Ascending bool
+		// Limit is the max number of routes returned, 0 means no limit.
+		Limit int
+	}
+)
+
+// statusFields maps the json name of the numeric fields in StatisticsMetric
+// to their indexes.
+var statusFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(StatisticsMetric{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch f.Type.Kind() {
+		case reflect.Uint64, reflect.Float64:
+		default:
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		fields[name] = i
+	}
+	return fields
+}()
+
+// StatusField returns the value of the numeric field of the status by its json name.
+func (s *Status) StatusField(name string) (float64, bool) {
+	idx, exists := statusFields[name]
+	if !exists {
+		return 0, false
+	}
+	v := reflect.ValueOf(&s.StatisticsMetric).Elem().Field(idx)
+	if v.Kind() == reflect.Uint64 {
+		return float64(v.Uint()), true
+	}
+	return v.Float(), true
+}
+
+// HTTPStatus returns the status of the http routes generated at the last
+// statistic tick, filtered and sorted by the query.
+func (hub *MetricsHub) HTTPStatus(query *StatsQuery) ([]*RouteStatus, error) {
+	if query == nil {
+		query = &StatsQuery{}
+	}
+	if query.SortBy != "" {
+		if _, exists := statusFields[query.SortBy]; !exists {
+			return nil, fmt.Errorf("unknown sort field: %s", query.SortBy)
+		}
+	}
+
+	hub.httpStatsMutex.RLock()
+	result := make([]*RouteStatus, 0, len(hub.httpStatus))
+	for key, status := range hub.httpStatus {
+		if query.Direction != "" && query.Direction != key.Direction {
+			continue
+		}
+		if query.Method != "" && !strings.EqualFold(query.Method, key.Method) {
+			continue
+		}
+		if !strings.HasPrefix(key.Path, query.PathPrefix) {
+			continue
+		}
+		result = append(result, &RouteStatus{
+			Direction: key.Direction,
+			Target:    key.Target,
+			Method:    key.Method,
+			Path:      key.Path,
+			Labels:    maps.Clone(hub.httpStats[key].extraLabels),
+			Status:    status,
+			extra:     key.Extra,
+		})
+	}
+	hub.httpStatsMutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if query.SortBy != "" {
+			vi, _ := result[i].StatusField(query.SortBy)
+			vj, _ := result[j].StatusField(query.SortBy)
+			if vi != vj {
+				if query.Ascending {
+					return vi < vj
+				}
+				return vi > vj
+			}
+		}
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		if result[i].Method != result[j].Method {
+			return result[i].Method < result[j].Method
+		}
+		if result[i].Direction != result[j].Direction {
+			return result[i].Direction > result[j].Direction
+		}
+		if result[i].Target != result[j].Target {
+			return result[i].Target < result[j].Target
+		}
+		return result[i].extra < result[j].extra
+	})
+
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+// Key returns the key of the route in the stats document, it is "METHOD path",
+// followed by "@target" for the client direction and the extra labels if any,
+// e.g. "GET /api/v1/vm", "GET /api/v1/vm @api.example.com {tenant=\"a\"}".
+func (r *RouteStatus) Key() string {
+	key := r.Method + " " + r.Path
+	if r.Direction == DirectionClient {
+		key += " @" + r.Target
+	}
+	if len(r.Labels) > 0 {
+		key += " " + formatLabels(r.Labels)
+	}
+	return key
+}
+
+// StatsHandler returns an HTTP handler serving the status of the http routes in a JSON
+// document keyed by RouteStatus.Key, the keys are in the order of the sorted routes.
+// It supports the following query parameters:
+//   - direction: filter the routes by the direction, server or client.
+//   - prefix: filter the routes by the path prefix.
+//   - method: filter the routes by the method.
+//   - sort: sort the routes by the json name of a numeric field, e.g. p99.
+//   - order: asc or desc, default is desc.
+//   - limit: the max number of routes returned.
+//
+// For example, GET /stats?sort=p99&limit=10 returns the top 10 routes by p99.
+func (hub *MetricsHub) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		query := &StatsQuery{
+			Direction:  q.Get("direction"),
+			PathPrefix: q.Get("prefix"),
+			Method:     q.Get("method"),
+			SortBy:     q.Get("sort"),
+		}
+		switch order := q.Get("order"); order {
+		case "", "desc":
+		case "asc":
+			query.Ascending = true
+		default:
+			http.Error(w, fmt.Sprintf("invalid order: %s", order), http.StatusBadRequest)
+			return
+		}
+		if limit := q.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+				return
+			}
+			query.Limit = n
+		}
+
+		result, err := hub.HTTPStatus(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, err := statsDocument(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// statsDocument encodes the routes into a JSON object keyed by RouteStatus.Key,
+// it is written manually to keep the order of the routes.
+func statsDocument(routes []*RouteStatus) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, route := range routes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(route.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(route)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// formatLabels formats the labels as `{key="value", ...}` sorted by the keys.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, value))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -0,0 +1,77 @@
+package metricshub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsHandler(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 10 * time.Millisecond}, "GET", "/api/v1/vm")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 300 * time.Millisecond}, "POST", "/api/v1/vm")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 500, Duration: 100 * time.Millisecond}, "GET", "/api/v1/disk")
+	hub.UpdateHTTPRequestMetrics(&RequestMetric{StatusCode: 200, Duration: 900 * time.Millisecond}, "GET", "/internal/sync")
+	hub.updateHTTPStatus()
+
+	// get returns the routes in the order of the keys of the document.
+	get := func(url string) (int, []*RouteStatus) {
+		w := httptest.NewRecorder()
+		hub.StatsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		var result []*RouteStatus
+		dec := json.NewDecoder(w.Body)
+		_, err := dec.Token()
+		assert.NoError(t, err)
+		for dec.More() {
+			key, err := dec.Token()
+			assert.NoError(t, err)
+			var route RouteStatus
+			assert.NoError(t, dec.Decode(&route))
+			assert.Equal(t, key, route.Key())
+			result = append(result, &route)
+		}
+		return w.Code, result
+	}
+
+	code, result := get("/stats")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, result, 4)
+	assert.Equal(t, "GET /api/v1/disk", result[0].Key())
+
+	code, result = get("/stats?prefix=/api/&sort=p99&limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "POST", result[0].Method)
+	assert.Equal(t, "/api/v1/vm", result[0].Path)
+	assert.Equal(t, "/api/v1/disk", result[1].Path)
+	assert.Equal(t, map[int]uint64{500: 1}, result[1].Codes)
+
+	code, result = get("/stats?method=get&sort=p99&order=asc")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, result, 3)
+	assert.Equal(t, "/api/v1/vm", result[0].Path)
+	assert.Equal(t, "/internal/sync", result[2].Path)
+
+	code, _ = get("/stats?sort=unknown")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRouteStatusKey(t *testing.T) {
+	assert.Equal(t, "GET /api/v1/vm", (&RouteStatus{Direction: DirectionServer, Method: "GET", Path: "/api/v1/vm"}).Key())
+	assert.Equal(t, `POST /api/v1/vm @api.example.com {tenant="a"}`, (&RouteStatus{
+		Direction: DirectionClient,
+		Target:    "api.example.com",
+		Method:    "POST",
+		Path:      "/api/v1/vm",
+		Labels:    map[string]string{"tenant": "a"},
+	}).Key())
+}
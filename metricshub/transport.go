@@ -0,0 +1,318 @@
+package metricshub
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// TransportOptions is the options of the instrumented transport.
+	TransportOptions struct {
+		// RouteFunc returns the route template of the outbound request, e.g. "/api/v1/vm/:id".
+		// Default is the route set by WithClientRoute, or the normalized path of the request.
+		// +optional
+		RouteFunc func(req *http.Request) string
+		// TargetFunc returns the target of the outbound request.
+		// Default is the host of the request URL.
+		// +optional
+		TargetFunc func(req *http.Request) string
+		// DisableTrace is the flag to disable the DNS, connect, TLS handshake and
+		// time to first byte histograms collected via httptrace.
+		// Default is false.
+		// +optional
+		DisableTrace bool
+	}
+
+	// instrumentedTransport collects the metrics of the outbound http requests.
+	instrumentedTransport struct {
+		hub     *MetricsHub
+		base    http.RoundTripper
+		options TransportOptions
+	}
+
+	// clientTrace observes the connection phases of an outbound request.
+	clientTrace struct {
+		metrics *httpRequestMetrics
+		target  string
+
+		mutex        sync.Mutex
+		startAt      time.Time
+		dnsStart     time.Time
+		connectStart map[string]time.Time
+		tlsStart     time.Time
+	}
+
+	// countingReader counts the bytes read from the body, the request body is
+	// read by the transport while the size is read when the request is collected.
+	countingReader struct {
+		io.ReadCloser
+		size atomic.Uint64
+	}
+
+	// instrumentedBody collects the metrics of the request when the response
+	// body is read to the end, failed or closed.
+	instrumentedBody struct {
+		io.ReadCloser
+		size   uint64
+		once   sync.Once
+		finish func(size uint64, err error)
+	}
+
+	clientRouteKey struct{}
+)
+
+// WithClientRoute returns a copy of the context with the route template of the
+// outbound request, which is used by the instrumented transport as the path label.
+func WithClientRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, clientRouteKey{}, route)
+}
+
+// NewInstrumentedTransport creates an http.RoundTripper wrapping the base, which collects
+// the metrics of the outbound requests into the client direction of the hub, labeled by
+// the target host and the route template. The nil base means http.DefaultTransport, and
+// the nil options means the default options.
+//
+// The request is collected when the response body is read to the end or closed, so the
+// duration and the response size cover the body, except the upgraded connections (101),
+// which are collected when the response is received. Like what http.Client requires, the body
+// must be read to the end or closed, otherwise the request is never collected. The transport failures have no status
+// code, they are collected as server errors with the cause, e.g. "dns", "connection_refused",
+// except the requests canceled by the caller, which are client errors.
+func NewInstrumentedTransport(hub *MetricsHub, base http.RoundTripper, options *TransportOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &instrumentedTransport{
+		hub:  hub,
+		base: base,
+	}
+	if options != nil {
+		t.options = *options
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startAt := fasttime.Now()
+	key := httpStatsKey{
+		Direction: DirectionClient,
+		Target:    t.target(req),
+		Method:    req.Method,
+		Path:      t.route(req),
+	}
+
+	ctx := req.Context()
+	if !t.options.DisableTrace {
+		trace := &clientTrace{
+			metrics:      t.hub.clientMetrics,
+			target:       key.Target,
+			startAt:      startAt,
+			connectStart: make(map[string]time.Time),
+		}
+		ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	}
+	req = req.Clone(ctx)
+
+	var reqBody *countingReader
+	if req.Body != nil && req.Body != http.NoBody {
+		reqBody = &countingReader{ReadCloser: req.Body}
+		req.Body = reqBody
+	}
+	reqSize := func() uint64 {
+		if reqBody != nil {
+			return reqBody.size.Load()
+		}
+		if req.ContentLength > 0 {
+			return uint64(req.ContentLength)
+		}
+		return 0
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.hub.updateRequestMetrics(&RequestMetric{
+			Duration: fasttime.Since(startAt),
+			ReqSize:  reqSize(),
+			Err:      err,
+			Cause:    transportCause(err),
+			RawPath:  req.URL.Path,
+		}, key)
+		return resp, err
+	}
+
+	// The response is returned when its header is received.
+	ttfb := fasttime.Since(startAt)
+	body := &instrumentedBody{ReadCloser: resp.Body}
+	body.finish = func(size uint64, err error) {
+		m := &RequestMetric{
+			StatusCode: resp.StatusCode,
+			Duration:   fasttime.Since(startAt),
+			TTFB:       ttfb,
+			ReqSize:    reqSize(),
+			RespSize:   size,
+			Header:     resp.Header,
+			RawPath:    req.URL.Path,
+		}
+		if err != nil {
+			m.Err = err
+			m.Cause = transportCause(err)
+		}
+		t.hub.updateRequestMetrics(m, key)
+	}
+	// The body of an upgraded connection is an io.ReadWriteCloser used by the caller,
+	// e.g. httputil.ReverseProxy, so it is returned untouched.
+	if resp.StatusCode == http.StatusSwitchingProtocols || resp.Body == nil || resp.Body == http.NoBody {
+		body.close(nil)
+		return resp, nil
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+func (t *instrumentedTransport) target(req *http.Request) string {
+	if t.options.TargetFunc != nil {
+		return t.options.TargetFunc(req)
+	}
+	return req.URL.Host
+}
+
+func (t *instrumentedTransport) route(req *http.Request) string {
+	if t.options.RouteFunc != nil {
+		return t.options.RouteFunc(req)
+	}
+	if route, ok := req.Context().Value(clientRouteKey{}).(string); ok && route != "" {
+		return route
+	}
+	return t.hub.NormalizePath(req.URL.Path)
+}
+
+// Read implements io.Reader.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size.Add(uint64(n))
+	return n, err
+}
+
+// Read implements io.Reader.
+func (b *instrumentedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += uint64(n)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		b.close(nil)
+	default:
+		b.close(err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *instrumentedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.close(nil)
+	return err
+}
+
+func (b *instrumentedBody) close(err error) {
+	b.once.Do(func() { b.finish(b.size, err) })
+}
+
+func (ct *clientTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			ct.mutex.Lock()
+			ct.dnsStart = fasttime.Now()
+			ct.mutex.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			ct.mutex.Lock()
+			start := ct.dnsStart
+			ct.mutex.Unlock()
+			ct.observe(ct.metrics.DNSDuration, start)
+		},
+		ConnectStart: func(network, addr string) {
+			ct.mutex.Lock()
+			ct.connectStart[network+addr] = fasttime.Now()
+			ct.mutex.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			ct.mutex.Lock()
+			start := ct.connectStart[network+addr]
+			ct.mutex.Unlock()
+			if err == nil {
+				ct.observe(ct.metrics.ConnectDuration, start)
+			}
+		},
+		TLSHandshakeStart: func() {
+			ct.mutex.Lock()
+			ct.tlsStart = fasttime.Now()
+			ct.mutex.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			ct.mutex.Lock()
+			start := ct.tlsStart
+			ct.mutex.Unlock()
+			if err == nil {
+				ct.observe(ct.metrics.TLSHandshakeDuration, start)
+			}
+		},
+		GotFirstResponseByte: func() {
+			ct.observe(ct.metrics.FirstByteDuration, ct.startAt)
+		},
+	}
+}
+
+// observe observes the duration since the start, labeled by the target.
+func (ct *clientTrace) observe(o prometheus.ObserverVec, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	o.With(prometheus.Labels{"target": ct.target}).Observe(float64(fasttime.Since(start).Milliseconds()))
+}
+
+// transportCause returns the cause of the transport error.
+func transportCause(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CauseCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CauseDeadlineExceeded
+	case errors.As(err, &dnsErr):
+		return CauseDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return CauseConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return CauseConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &certErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &certInvalidErr):
+		return CauseTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CauseDeadlineExceeded
+	default:
+		return CauseTransport
+	}
+}
@@ -0,0 +1,171 @@
+package metricshub
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentedTransport(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: NewInstrumentedTransport(hub, srv.Client().Transport, nil),
+	}
+	target := strings.TrimPrefix(srv.URL, "https://")
+
+	resp, err := client.Post(srv.URL+"/vm/123", "text/plain", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	req, _ := http.NewRequestWithContext(WithClientRoute(context.Background(), "/:name"), http.MethodGet, srv.URL+"/missing", nil)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, err = (&http.Client{Transport: NewInstrumentedTransport(hub, nil, nil)}).Get(closed.URL + "/vm")
+	assert.Error(t, err)
+	hub.updateHTTPStatus()
+
+	result, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	routes := make(map[string]*RouteStatus)
+	for _, r := range result {
+		routes[r.Method+" "+r.Target+r.Path] = r
+	}
+
+	vm := routes["POST "+target+"/vm/:id"]
+	if assert.NotNil(t, vm) {
+		assert.Equal(t, uint64(5), vm.ReqSize)
+		assert.Equal(t, uint64(5), vm.RespSize)
+		assert.Equal(t, map[int]uint64{200: 1}, vm.Codes)
+	}
+	missing := routes["GET "+target+"/:name"]
+	if assert.NotNil(t, missing) {
+		assert.Equal(t, uint64(1), missing.ClientErrCount)
+	}
+	refused := routes["GET "+strings.TrimPrefix(closed.URL, "http://")+"/vm"]
+	if assert.NotNil(t, refused) {
+		assert.Equal(t, uint64(1), refused.ServerErrCount)
+		assert.Empty(t, refused.Codes)
+	}
+
+	failures := gatherMetrics(t, hub, "client_request_failures_total")
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, CauseConnectionRefused, labelValue(failures[0], "cause"))
+	}
+	// the connection is reused by the second request.
+	for name, count := range map[string]uint64{
+		"client_connect_duration":       1,
+		"client_tls_handshake_duration": 1,
+		"client_first_byte_duration":    2,
+	} {
+		metrics := gatherMetrics(t, hub, name)
+		if assert.Len(t, metrics, 1, name) {
+			assert.Equal(t, target, labelValue(metrics[0], "target"))
+			assert.Equal(t, count, metrics[0].GetHistogram().GetSampleCount(), name)
+		}
+	}
+}
+
+func TestInstrumentedTransportCanceled(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/vm", nil)
+	_, err := (&http.Client{Transport: NewInstrumentedTransport(hub, nil, nil)}).Do(req)
+	assert.ErrorIs(t, err, context.Canceled)
+	hub.updateHTTPStatus()
+
+	result, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, uint64(1), result[0].ClientErrCount)
+		assert.Equal(t, uint64(0), result[0].ServerErrCount)
+	}
+	failures := gatherMetrics(t, hub, "client_request_failures_total")
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, CauseCanceled, labelValue(failures[0], "cause"))
+	}
+}
+
+func TestInstrumentedTransportUpgrade(t *testing.T) {
+	hub := NewMetricsHub(&MetricsHubConfig{
+		ServiceName: "test",
+	})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.Transport = NewInstrumentedTransport(hub, nil, nil)
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// the upgraded connection is proxied through the body of the response.
+	conn.Write([]byte("ping"))
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(reader, echo)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(echo))
+
+	// the request is collected when the response is received.
+	hub.updateHTTPStatus()
+	result, err := hub.HTTPStatus(&StatsQuery{Direction: DirectionClient})
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, map[int]uint64{http.StatusSwitchingProtocols: 1}, result[0].Codes)
+	}
+}
@@ -0,0 +1,318 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+// The formats of the access log.
+const (
+	// AccessLogJSON writes the access log in JSON.
+	AccessLogJSON AccessLogFormat = "json"
+	// AccessLogLogfmt writes the access log in logfmt, i.e. key=value pairs.
+	AccessLogLogfmt AccessLogFormat = "logfmt"
+	// AccessLogCombined writes the access log in the Apache combined log format.
+	AccessLogCombined AccessLogFormat = "combined"
+
+	// redacted is the replacement of the redacted query parameters.
+	redacted = "REDACTED"
+)
+
+type (
+	// AccessLogFormat is the format of the access log.
+	AccessLogFormat string
+
+	// AccessLogConfig is the configuration of the access log emitted by the middlewares.
+	AccessLogConfig struct {
+		// Format is the format of the access log.
+		// Default is AccessLogJSON.
+		// +optional
+		Format AccessLogFormat `yaml:"format" json:"format"`
+		// Writer is where the access log is written.
+		// Default is os.Stdout.
+		// +optional
+		Writer io.Writer `yaml:"-" json:"-"`
+		// Handler is the slog handler to emit the access log, e.g. the handler of the
+		// application logger. Format and Writer are ignored if it is set.
+		// +optional
+		Handler slog.Handler `yaml:"-" json:"-"`
+		// SuccessSampleRate is the ratio of the successful requests to log, in (0, 1],
+		// the errors, i.e. the status code >= 400 or the handler returns an error,
+		// are always logged. Default is 0, which means all the requests are logged.
+		// +optional
+		SuccessSampleRate float64 `yaml:"successSampleRate" json:"successSampleRate"`
+		// ErrorsOnly is the flag to log the errors only.
+		// Default is false.
+		// +optional
+		ErrorsOnly bool `yaml:"errorsOnly" json:"errorsOnly"`
+		// RedactQueryParams is the list of the query parameters whose values are
+		// replaced by "REDACTED" in the logged URI, case-insensitive, "*" means all.
+		// +optional
+		RedactQueryParams []string `yaml:"redactQueryParams" json:"redactQueryParams"`
+	}
+
+	// accessLogger emits the access log of the requests.
+	accessLogger struct {
+		handler    slog.Handler
+		sampleRate float64
+		errorsOnly bool
+		redactAll  bool
+		redact     []string
+	}
+
+	// accessEntry is the fields of an access log entry, the status, the duration,
+	// the sizes and the error are of the metric of the request.
+	accessEntry struct {
+		StartAt    time.Time
+		RemoteAddr string
+		Method     string
+		URI        string
+		Proto      string
+		Route      string
+		Referer    string
+		UserAgent  string
+		Metric     *metricshub.RequestMetric
+	}
+
+	// combinedHandler is the slog handler writing the records of the access log
+	// in the Apache combined log format.
+	combinedHandler struct {
+		mutex  sync.Mutex
+		writer io.Writer
+	}
+)
+
+// WithAccessLog makes the middlewares emit the access log of the collected requests,
+// the excluded and the skipped requests are not logged.
+func WithAccessLog(config *AccessLogConfig) Option {
+	return func(o *options) {
+		o.accessLog = newAccessLogger(config)
+	}
+}
+
+func newAccessLogger(config *AccessLogConfig) *accessLogger {
+	if config == nil {
+		config = &AccessLogConfig{}
+	}
+	l := &accessLogger{
+		handler:    config.Handler,
+		sampleRate: config.SuccessSampleRate,
+		errorsOnly: config.ErrorsOnly,
+	}
+	for _, p := range config.RedactQueryParams {
+		if p == "*" {
+			l.redactAll = true
+		}
+		l.redact = append(l.redact, strings.ToLower(p))
+	}
+	if l.handler != nil {
+		return l
+	}
+
+	w := config.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	opts := &slog.HandlerOptions{ReplaceAttr: replaceTime}
+	switch config.Format {
+	case AccessLogLogfmt:
+		l.handler = slog.NewTextHandler(w, opts)
+	case AccessLogCombined:
+		l.handler = &combinedHandler{writer: w}
+	default:
+		l.handler = slog.NewJSONHandler(w, opts)
+	}
+	return l
+}
+
+// replaceTime formats the time of the records by fasttime.
+func replaceTime(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+		return slog.String(slog.TimeKey, fasttime.Format(a.Value.Time(), fasttime.RFC3339Milli))
+	}
+	return a
+}
+
+// sampled returns true if the request should be logged, it is safe to call on nil.
+func (l *accessLogger) sampled(status int, err error) bool {
+	if l == nil {
+		return false
+	}
+	if status >= 400 || err != nil {
+		return true
+	}
+	if l.errorsOnly {
+		return false
+	}
+	return l.sampleRate <= 0 || l.sampleRate >= 1 || rand.Float64() < l.sampleRate
+}
+
+// logRequest emits the access log entry of the request served by net/http if it is sampled.
+func (l *accessLogger) logRequest(r *http.Request, startAt time.Time, method, route string, m *metricshub.RequestMetric) {
+	if !l.sampled(m.StatusCode, m.Err) {
+		return
+	}
+	l.log(&accessEntry{
+		StartAt:    startAt,
+		RemoteAddr: r.RemoteAddr,
+		Method:     method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Route:      route,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		Metric:     m,
+	})
+}
+
+// log emits the access log entry.
+func (l *accessLogger) log(e *accessEntry) {
+	m := e.Metric
+	level := slog.LevelInfo
+	switch {
+	case m.StatusCode >= 500:
+		level = slog.LevelError
+	case m.StatusCode >= 400:
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(e.StartAt, level, "access", 0)
+	r.AddAttrs(
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("method", e.Method),
+		slog.String("uri", l.redactURI(e.URI)),
+		slog.String("proto", e.Proto),
+		slog.String("route", e.Route),
+		slog.Int("status", m.StatusCode),
+		slog.Int64("duration_ms", m.Duration.Milliseconds()),
+		slog.Uint64("req_size", m.ReqSize),
+		slog.Uint64("resp_size", m.RespSize),
+		slog.String("referer", e.Referer),
+		slog.String("user_agent", e.UserAgent),
+	)
+	if m.Err != nil {
+		r.AddAttrs(slog.String("error", m.Err.Error()))
+	}
+	_ = l.handler.Handle(ctx, r)
+}
+
+// redactURI replaces the values of the redacted query parameters of the URI.
+func (l *accessLogger) redactURI(uri string) string {
+	if len(l.redact) == 0 {
+		return uri
+	}
+	path, query, found := strings.Cut(uri, "?")
+	if !found || query == "" {
+		return uri
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, hasValue := strings.Cut(param, "=")
+		if !hasValue {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if l.redactAll || slices.Contains(l.redact, strings.ToLower(name)) {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// Enabled implements slog.Handler.
+func (h *combinedHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements slog.Handler, it writes the record in the format:
+// remote_addr - - [time] "method uri proto" status resp_size "referer" "user_agent"
+func (h *combinedHandler) Handle(_ context.Context, r slog.Record) error {
+	var remoteAddr, method, uri, proto, status, size, referer, userAgent string
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "remote_addr":
+			remoteAddr = a.Value.String()
+		case "method":
+			method = a.Value.String()
+		case "uri":
+			uri = a.Value.String()
+		case "proto":
+			proto = a.Value.String()
+		case "status":
+			status = a.Value.String()
+		case "resp_size":
+			size = a.Value.String()
+		case "referer":
+			referer = a.Value.String()
+		case "user_agent":
+			userAgent = a.Value.String()
+		}
+		return true
+	})
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	var sb strings.Builder
+	sb.WriteString(dashIfEmpty(remoteAddr))
+	sb.WriteString(" - - [")
+	sb.WriteString(fasttime.Format(r.Time, fasttime.CommonLog))
+	sb.WriteString("] ")
+	sb.WriteString(strconv.Quote(method + " " + uri + " " + proto))
+	sb.WriteByte(' ')
+	sb.WriteString(status)
+	sb.WriteByte(' ')
+	if size == "0" {
+		size = ""
+	}
+	sb.WriteString(dashIfEmpty(size))
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.Quote(dashIfEmpty(referer)))
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.Quote(dashIfEmpty(userAgent)))
+	sb.WriteByte('\n')
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := io.WriteString(h.writer, sb.String())
+	return err
+}
+
+// WithAttrs implements slog.Handler, the attributes are not part of the format.
+func (h *combinedHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+// WithGroup implements slog.Handler, the groups are not part of the format.
+func (h *combinedHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	handler := NewHTTPMetricsHandler(newTestHub(), mux, WithAccessLog(&AccessLogConfig{
+		Writer:            &buf,
+		RedactQueryParams: []string{"Token"},
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/vm/1?token=secret&a=b", nil)
+	req.Header.Set("User-Agent", "test")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "access", entry["msg"])
+	assert.Equal(t, "/vm/1?token=REDACTED&a=b", entry["uri"])
+	assert.Equal(t, "/vm/{id}", entry["route"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(5), entry["resp_size"])
+	assert.Equal(t, "test", entry["user_agent"])
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`, entry["time"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewHTTPMetricsHandler(newTestHub(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}), WithAccessLog(&AccessLogConfig{
+		Writer:     &buf,
+		Format:     AccessLogLogfmt,
+		ErrorsOnly: true,
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "level=ERROR")
+	assert.Contains(t, lines[0], "uri=/fail")
+	assert.Contains(t, lines[0], "status=500")
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(NewGinMetricsCollector(newTestHub(), WithAccessLog(&AccessLogConfig{
+		Writer:            &buf,
+		Format:            AccessLogCombined,
+		RedactQueryParams: []string{"*"},
+	})))
+	r.GET("/vm/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/vm/1?a=b&c", nil)
+	req.Header.Set("Referer", "http://example.com/")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	re := regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /vm/1\?a=REDACTED&c HTTP/1\.1" 200 5 "http://example.com/" "-"\n$`)
+	assert.Regexp(t, re, buf.String())
+}
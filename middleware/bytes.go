@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/metrics-go/metricshub"
+)
+
+// bodyReader counts the bytes read from the request body, so the size of
+// the chunked and streaming bodies without Content-Length is collected.
+type bodyReader struct {
+	io.ReadCloser
+	size int64
+}
+
+// Read implements io.Reader.
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// wrapBody wraps the body of the request with a bodyReader,
+// it returns nil if the request has no body.
+func wrapBody(r *http.Request) *bodyReader {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := &bodyReader{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
+
+// requestSize returns the size of the request body, it is the bytes read
+// from the body or the Content-Length, whichever is larger, since the
+// handler may not read the whole body.
+func requestSize(r *http.Request, body *bodyReader) uint64 {
+	size := max(r.ContentLength, 0)
+	if body != nil {
+		size = max(size, body.size)
+	}
+	return uint64(size)
+}
+
+// addHeaderBytes adds the sizes of the request and response headers to the metric.
+func addHeaderBytes(m *metricshub.RequestMetric, r *http.Request) {
+	m.ReqSize += requestHeaderSize(r)
+	respHeaderSize := responseHeaderSize(r.Proto, m.StatusCode, m.Header)
+	m.RespSize += respHeaderSize
+	if m.RespUncompressedSize > 0 {
+		m.RespUncompressedSize += respHeaderSize
+	}
+}
+
+// requestHeaderSize returns the size of the request line and headers in HTTP/1.1 format.
+func requestHeaderSize(r *http.Request) uint64 {
+	// "METHOD URI PROTO\r\n"
+	size := len(r.Method) + 1 + len(r.RequestURI) + 1 + len(r.Proto) + 2
+	if r.Header.Get("Host") == "" {
+		// "Host: host\r\n", the Host header is removed by net/http.
+		size += len("Host") + 2 + len(r.Host) + 2
+	}
+	return uint64(size + headerSize(r.Header))
+}
+
+// responseHeaderSize returns the size of the status line and headers in HTTP/1.1 format.
+func responseHeaderSize(proto string, statusCode int, header http.Header) uint64 {
+	// "PROTO CODE TEXT\r\n"
+	size := len(proto) + 1 + len(strconv.Itoa(statusCode)) + 1 + len(http.StatusText(statusCode)) + 2
+	return uint64(size + headerSize(header))
+}
+
+// headerSize returns the size of the headers in HTTP/1.1 format, including the ending CRLF.
+func headerSize(header http.Header) int {
+	size := 2
+	for key, values := range header {
+		for _, value := range values {
+			// "Key: value\r\n"
+			size += len(key) + 2 + len(value) + 2
+		}
+	}
+	return size
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	echo "github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// ginGzipWriter compresses the response like the gzip middleware of gin-contrib.
+type ginGzipWriter struct {
+	gin.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w *ginGzipWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+func (w *ginGzipWriter) WriteString(s string) (int, error) {
+	return w.writer.Write([]byte(s))
+}
+
+func TestHTTPRequestSizeChunked(t *testing.T) {
+	hub := newTestHub()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Test", "ok")
+		io.WriteString(w, "done")
+	})
+	handler := NewHTTPMetricsHandler(hub, mux, WithHeaderBytes())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 1000)))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// "POST /upload HTTP/1.1\r\n" + "Host: example.com\r\n" + "\r\n"
+	reqSize := 1000 + 23 + 19 + 2
+	// "HTTP/1.1 200 OK\r\n" + "X-Test: ok\r\n" + "Content-Type: text/plain; charset=utf-8\r\n" + "\r\n"
+	respSize := 4 + 17 + 12 + 41 + 2
+	assert.Contains(t, scrapeMetric(hub, "requests_size_bytes_sum"), `path="/upload",service_name="test",target="",type="http-request"} `+strconv.Itoa(reqSize))
+	assert.Contains(t, scrapeMetric(hub, "responses_size_bytes_sum"), `path="/upload",service_name="test",target="",type="http-request"} `+strconv.Itoa(respSize))
+}
+
+func TestEchoCompressedSize(t *testing.T) {
+	hub := newTestHub()
+
+	e := echo.New()
+	e.Use(NewEchoMetricsCollector(hub))
+	e.Use(echomiddleware.Gzip())
+	e.POST("/vm", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, strings.Repeat(string(body), 100))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/vm", strings.NewReader("hello"))
+	req.ContentLength = -1
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	assert.Contains(t, scrapeMetric(hub, "requests_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} 5`)
+	assert.Contains(t, scrapeMetric(hub, "responses_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} `+strconv.Itoa(w.Body.Len()))
+	assert.Contains(t, scrapeMetric(hub, "responses_uncompressed_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} 500`)
+}
+
+func TestGinCompressedSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newTestHub()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		gw := gzip.NewWriter(c.Writer)
+		c.Header("Content-Encoding", "gzip")
+		c.Writer = &ginGzipWriter{ResponseWriter: c.Writer, writer: gw}
+		c.Next()
+		gw.Close()
+	})
+	r.Use(NewGinMetricsCollector(hub))
+	r.GET("/vm", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("hello", 100))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm", nil))
+
+	// the gzip writer is closed after the collector returns, so the compressed size
+	// only counts the 10 bytes gzip header written before, the uncompressed size is exact.
+	assert.Contains(t, scrapeMetric(hub, "responses_uncompressed_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} 500`)
+	assert.Contains(t, scrapeMetric(hub, "responses_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} 10`)
+}
+
+func TestGinCompressedSizeCollectorFirst(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newTestHub()
+
+	r := gin.New()
+	r.Use(NewGinMetricsCollector(hub))
+	r.Use(func(c *gin.Context) {
+		gw := gzip.NewWriter(c.Writer)
+		c.Header("Content-Encoding", "gzip")
+		c.Writer = &ginGzipWriter{ResponseWriter: c.Writer, writer: gw}
+		c.Next()
+		gw.Close()
+	})
+	r.GET("/vm", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("hello", 100))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm", nil))
+
+	// the collector only sees the compressed bytes.
+	assert.Contains(t, scrapeMetric(hub, "responses_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} `+strconv.Itoa(w.Body.Len()))
+	assert.Contains(t, scrapeMetric(hub, "responses_uncompressed_size_bytes_sum"), `path="/vm",service_name="test",target="",type="http-request"} `+strconv.Itoa(w.Body.Len()))
+}
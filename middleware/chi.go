@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/megaease/metrics-go/metricshub"
+)
+
+// NewChiMetricsCollector creates a chi middleware to collect HTTP request metrics.
+// The requests are grouped by the route pattern of chi, e.g. "/vm/{id}".
+func NewChiMetricsCollector(hub *metricshub.MetricsHub, opts ...Option) func(http.Handler) http.Handler {
+	opts = append([]Option{WithRouteFunc(chiRoutePattern)}, opts...)
+	return func(next http.Handler) http.Handler {
+		return NewHTTPMetricsHandler(hub, next, opts...)
+	}
+}
+
+// chiRoutePattern returns the route pattern matched by chi, the routing
+// context is filled after the request is served.
+func chiRoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChiMetricsCollector(t *testing.T) {
+	hub := newTestHub()
+
+	router := chi.NewRouter()
+	router.Use(NewChiMetricsCollector(hub))
+	router.Route("/api", func(r chi.Router) {
+		r.Get("/vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+	})
+
+	for _, url := range []string{"/api/vm/1", "/api/vm/2", "/random/url"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	metrics := scrape(hub)
+	assert.Contains(t, metrics, `http_responses_total{class="2xx",code="200",direction="server",method="GET",path="/api/vm/{id}",service_name="test",target="",type="http-request"} 2`)
+	assert.Contains(t, metrics, `http_responses_total{class="4xx",code="404",direction="server",method="GET",path="UNMATCHED",service_name="test",target="",type="http-request"} 1`)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	echo "github.com/labstack/echo/v4"
+)
+
+// Context is the framework-neutral view of a request passed to the hooks
+// set by WithSkipper, WithGroupPath and WithExtraLabels.
+type Context interface {
+	// Method returns the method of the request.
+	Method() string
+	// Path returns the raw URL path of the request.
+	Path() string
+	// Route returns the route template of the request, e.g. "/vm/:id",
+	// it is empty if the route is not matched or not known yet.
+	Route() string
+	// Header returns the first value of the request header.
+	Header(key string) string
+	// Native returns the context of the framework, i.e. *gin.Context,
+	// echo.Context, *fiber.Ctx or *http.Request.
+	Native() any
+}
+
+type (
+	ginContext struct {
+		c *gin.Context
+	}
+
+	echoContext struct {
+		c echo.Context
+	}
+
+	httpContext struct {
+		r     *http.Request
+		route string
+	}
+
+	// fiberContext copies the strings of fiber.Ctx, since they are only valid in the handler.
+	fiberContext struct {
+		c     *fiber.Ctx
+		route string
+	}
+)
+
+var (
+	_ Context = ginContext{}
+	_ Context = echoContext{}
+	_ Context = (*httpContext)(nil)
+	_ Context = (*fiberContext)(nil)
+)
+
+func (c ginContext) Method() string           { return c.c.Request.Method }
+func (c ginContext) Path() string             { return c.c.Request.URL.Path }
+func (c ginContext) Route() string            { return c.c.FullPath() }
+func (c ginContext) Header(key string) string { return c.c.GetHeader(key) }
+func (c ginContext) Native() any              { return c.c }
+
+func (c echoContext) Method() string           { return c.c.Request().Method }
+func (c echoContext) Path() string             { return c.c.Request().URL.Path }
+func (c echoContext) Route() string            { return c.c.Path() }
+func (c echoContext) Header(key string) string { return c.c.Request().Header.Get(key) }
+func (c echoContext) Native() any              { return c.c }
+
+func (c *httpContext) Method() string           { return c.r.Method }
+func (c *httpContext) Path() string             { return c.r.URL.Path }
+func (c *httpContext) Route() string            { return c.route }
+func (c *httpContext) Header(key string) string { return c.r.Header.Get(key) }
+func (c *httpContext) Native() any              { return c.r }
+
+func (c *fiberContext) Method() string           { return utils.CopyString(c.c.Method()) }
+func (c *fiberContext) Path() string             { return utils.CopyString(c.c.Path()) }
+func (c *fiberContext) Route() string            { return c.route }
+func (c *fiberContext) Header(key string) string { return utils.CopyString(c.c.Get(key)) }
+func (c *fiberContext) Native() any              { return c.c }
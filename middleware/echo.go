@@ -1,49 +1,108 @@
 package middleware
 
 import (
+	"net/http"
+	"sync"
+
 	echo "github.com/labstack/echo/v4"
 	"github.com/megaease/metrics-go/metricshub"
 	"github.com/megaease/metrics-go/utils/fasttime"
 )
 
 // NewEchoMetricsCollector creates a Echo middleware to collect HTTP request metrics.
-func NewEchoMetricsCollector(hub *metricshub.MetricsHub) echo.MiddlewareFunc {
+func NewEchoMetricsCollector(hub *metricshub.MetricsHub, opts ...Option) echo.MiddlewareFunc {
+	o := newOptions(opts)
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
+			if o.skip(echoContext{ctx}) {
+				return next(ctx)
+			}
+
 			startAt := fasttime.Now()
+			body := wrapBody(ctx.Request())
+			// The writer counts the bytes on the wire, the size of the response counts
+			// the bytes before they are compressed by a gzip middleware after this one.
+			writer := ctx.Response().Writer
+			rw := newResponseWriter(writer)
+			ctx.Response().Writer = rw
+
+			// The upgraded and SSE connections are tracked as long-lived connections
+			// rather than requests, so they don't skew the request latency.
+			// The route is matched before the middlewares are called.
+			done := sync.OnceFunc(hub.TrackHTTPRequest(ctx.Request().Method, ctx.Path(), ctx.Request().URL.Path))
+			defer done()
+			ctx.SetRequest(rw.track(ctx.Request(), func(kind string) *metricshub.Connection {
+				done()
+				return hub.TrackConnection(kind, hub.RoutePath(ctx.Path(), ctx.Request().URL.Path, http.StatusOK))
+			}))
+
+			// collect returns false if the request is excluded.
+			collect := func(code int, err error, recovered any) bool {
+				if rw.conn != nil {
+					rw.conn.Close()
+					return true
+				}
+				processTime := fasttime.Since(startAt)
+				path := hub.RoutePath(ctx.Path(), ctx.Request().URL.Path, code)
+				if hub.IsExcludedHttpRequest(ctx.Request().Method, path) {
+					return false
+				}
+
+				method := ctx.Request().Method
+				bodyBytesReceived := requestSize(ctx.Request(), body)
+				bodyBytesSent := uint64(rw.Size())
+
+				// We use the registered router path as the group path if it is not overridden.
+				groupPath := o.group(echoContext{ctx}, path)
+
+				requestMetric := &metricshub.RequestMetric{
+					StatusCode: code,
+					Duration:   processTime,
+					ReqSize:    bodyBytesReceived,
+					RespSize:   bodyBytesSent,
+					Err:        err,
+					Header:     ctx.Response().Header(),
+					Labels:     o.labels(echoContext{ctx}),
+					TTFB:       ttfb(startAt, rw.FirstByteAt(), processTime),
+					QueueTime:  queueTime(ctx.Request().Header.Get, startAt),
+					RawPath:    ctx.Request().URL.Path,
+					TraceID:    traceID(ctx.Request().Header.Get),
+				}
+				if uncompressed := uint64(max(ctx.Response().Size, 0)); uncompressed != bodyBytesSent {
+					requestMetric.RespUncompressedSize = uncompressed
+				}
+				if o.headerBytes {
+					addHeaderBytes(requestMetric, ctx.Request())
+				}
+				if recovered != nil {
+					requestMetric.Err = panicError(recovered)
+					requestMetric.Panicked = true
+				}
+				hub.UpdateHTTPRequestMetrics(requestMetric, method, groupPath)
+				o.accessLog.logRequest(ctx.Request(), startAt, method, groupPath, requestMetric)
+				return true
+			}
+
+			// Collect the request even if the handler panics, and re-panic
+			// so the recover middleware registered before still works.
+			defer func() {
+				if rec := recover(); rec != nil {
+					ctx.Response().Writer = writer
+					collect(http.StatusInternalServerError, nil, rec)
+					panic(rec)
+				}
+			}()
 
 			err := next(ctx)
 			if err != nil {
 				ctx.Error(err)
 			}
-			processTime := fasttime.Since(startAt)
-			path := ctx.Path()
-			if hub.IsExcludedHttpPath(path) {
+			ctx.Response().Writer = writer
+			if !collect(ctx.Response().Status, err, nil) {
 				return nil
 			}
 
-			method := ctx.Request().Method
-			code := ctx.Response().Status
-			bodyBytesReceived := ctx.Request().ContentLength
-			if bodyBytesReceived < 0 {
-				bodyBytesReceived = 0
-			}
-			bodyBytesSent := ctx.Response().Size
-			if bodyBytesSent < 0 {
-				bodyBytesSent = 0
-			}
-
-			// We just use the registered router path as the group path.
-			groupPath := path
-
-			requestMetric := &metricshub.RequestMetric{
-				StatusCode: code,
-				Duration:   processTime,
-				ReqSize:    uint64(bodyBytesReceived),
-				RespSize:   uint64(bodyBytesSent),
-			}
-			hub.UpdateHTTPRequestMetrics(requestMetric, method, groupPath)
-
 			return err
 		}
 	}
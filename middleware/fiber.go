@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+// NewFiberMetricsCollector creates a Fiber middleware to collect HTTP request metrics.
+// The error returned by the next handlers is handled by the error handler of the app
+// in the middleware, like the logger middleware of Fiber, so the status collected is
+// the one responded, and the error doesn't reach the middlewares registered before.
+//
+// The long-lived connections are not tracked for Fiber: the upgraded connections
+// (101 or hijacked) and the event streams of fasthttp are served after the handlers
+// return, so they are neither collected as requests nor tracked as connections.
+func NewFiberMetricsCollector(hub *metricshub.MetricsHub, opts ...Option) fiber.Handler {
+	o := newOptions(opts)
+
+	return func(c *fiber.Ctx) error {
+		if o.skip(&fiberContext{c: c}) {
+			return c.Next()
+		}
+
+		startAt := fasttime.Now()
+		// The route is unknown until the next handlers are called,
+		// so only the service-wide in-flight requests are tracked.
+		done := hub.TrackHTTPRequest(c.Method(), "", c.Path())
+		defer done()
+
+		collect := func(code int, err error, matched bool, recovered any) {
+			processTime := fasttime.Since(startAt)
+			// The upgraded connections and the event streams are not collected
+			// to avoid skewing the request latency.
+			if c.Context().Hijacked() || code == http.StatusSwitchingProtocols ||
+				isEventStream(string(c.Response().Header.ContentType())) {
+				return
+			}
+
+			// The strings of fiber.Ctx are only valid in the handler, copy them.
+			method := utils.CopyString(c.Method())
+			route := ""
+			if matched {
+				route = c.Route().Path
+			}
+			rawPath := utils.CopyString(c.Path())
+			path := hub.RoutePath(route, rawPath, code)
+			if hub.IsExcludedHttpRequest(method, path) {
+				return
+			}
+			fctx := &fiberContext{c: c, route: path}
+			header := fctx.Header
+			path = utils.CopyString(o.group(fctx, path))
+
+			bodyBytesReceived := c.Request().Header.ContentLength()
+			if bodyBytesReceived < 0 {
+				bodyBytesReceived = len(c.Request().Body())
+			}
+			bodyBytesSent := len(c.Response().Body())
+			if c.Response().IsBodyStream() {
+				bodyBytesSent = max(c.Response().Header.ContentLength(), 0)
+			}
+
+			requestMetric := &metricshub.RequestMetric{
+				StatusCode: code,
+				Duration:   processTime,
+				ReqSize:    uint64(bodyBytesReceived),
+				RespSize:   uint64(bodyBytesSent),
+				Err:        err,
+				Header:     http.Header(c.GetRespHeaders()),
+				Labels:     copyLabels(o.labels(fctx)),
+				// The response of fasthttp is written after the handlers return,
+				// so the time to first byte is unknown.
+				QueueTime: queueTime(header, startAt),
+				RawPath:   rawPath,
+				TraceID:   traceID(header),
+			}
+			if o.headerBytes {
+				// The serialized headers of fasthttp include the request or status line.
+				requestMetric.ReqSize += uint64(len(c.Request().Header.Header()))
+				requestMetric.RespSize += uint64(len(c.Response().Header.Header()))
+			}
+			if recovered != nil {
+				requestMetric.Err = panicError(recovered)
+				requestMetric.Panicked = true
+			}
+			hub.UpdateHTTPRequestMetrics(requestMetric, method, path)
+			if o.accessLog.sampled(code, requestMetric.Err) {
+				o.accessLog.log(&accessEntry{
+					StartAt:    startAt,
+					RemoteAddr: c.Context().RemoteAddr().String(),
+					Method:     method,
+					URI:        utils.CopyString(c.OriginalURL()),
+					Proto:      string(c.Request().Header.Protocol()),
+					Route:      path,
+					Referer:    string(c.Request().Header.Referer()),
+					UserAgent:  string(c.Request().Header.UserAgent()),
+					Metric:     requestMetric,
+				})
+			}
+		}
+
+		// Collect the request even if the handler panics, and re-panic
+		// so the recover middleware registered before still works.
+		self := c.Route()
+		defer func() {
+			if rec := recover(); rec != nil {
+				collect(fiber.StatusInternalServerError, nil, fiberMatched(c, self, nil), rec)
+				panic(rec)
+			}
+		}()
+
+		err := c.Next()
+		matched := fiberMatched(c, self, err)
+		if err != nil {
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		collect(c.Response().StatusCode(), err, matched, nil)
+
+		return nil
+	}
+}
+
+// fiberMatched returns true if a route is matched by the request. The route of ctx
+// is still the collector itself, or Fiber's fallback without handlers, if there is no
+// other route, and it is a middleware registered after the collector if no route is
+// matched, in which case Fiber returns the 404 or 405 error from the last c.Next.
+func fiberMatched(c *fiber.Ctx, self *fiber.Route, err error) bool {
+	route := c.Route()
+	if route == self || len(route.Handlers) == 0 {
+		return false
+	}
+	if errors.Is(err, fiber.ErrMethodNotAllowed) {
+		return false
+	}
+	var e *fiber.Error
+	if errors.As(err, &e) && e.Code == fiber.StatusNotFound &&
+		strings.HasPrefix(e.Message, "Cannot "+c.Method()+" ") {
+		return false
+	}
+	return true
+}
+
+// copyLabels copies the values of the labels, since the strings of
+// fiber.Ctx extracted by the extractors are only valid in the handler.
+func copyLabels(labels map[string]string) map[string]string {
+	for k, v := range labels {
+		labels[k] = utils.CopyString(v)
+	}
+	return labels
+}
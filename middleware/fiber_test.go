@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiberMetricsCollector(t *testing.T) {
+	hub := newTestHub()
+
+	app := fiber.New()
+	app.Use(NewFiberMetricsCollector(hub))
+	app.Post("/vm/:id", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusCreated).SendString("created")
+	})
+	app.Get("/vm/:id", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "vm not found")
+	})
+	app.Get("/disk/:id", func(c *fiber.Ctx) error {
+		return errors.New("boom")
+	})
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/vm/1", strings.NewReader("{}")),
+		httptest.NewRequest(http.MethodPost, "/vm/2", strings.NewReader("{}")),
+		httptest.NewRequest(http.MethodGet, "/vm/1", nil),
+		httptest.NewRequest(http.MethodGet, "/disk/1", nil),
+		httptest.NewRequest(http.MethodGet, "/random/url", nil),
+	}
+	expected := []int{201, 201, 404, 500, 404}
+	for i, req := range requests {
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[i], resp.StatusCode)
+	}
+
+	assert.Contains(t, scrapeMetric(hub, "http_responses_total"), `http_responses_total{class="2xx",code="201",direction="server",method="POST",path="/vm/:id",service_name="test",target="",type="http-request"} 2`)
+	assert.Contains(t, scrapeMetric(hub, "requests_size_bytes_sum"), `requests_size_bytes_sum{direction="server",method="POST",path="/vm/:id",service_name="test",target="",type="http-request"} 4`)
+	assert.Contains(t, scrapeMetric(hub, "responses_size_bytes_sum"), `responses_size_bytes_sum{direction="server",method="POST",path="/vm/:id",service_name="test",target="",type="http-request"} 14`)
+	assert.Contains(t, scrapeMetric(hub, "http_responses_total"), `http_responses_total{class="4xx",code="404",direction="server",method="GET",path="/vm/:id",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, scrapeMetric(hub, "http_responses_total"), `http_responses_total{class="5xx",code="500",direction="server",method="GET",path="/disk/:id",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, scrapeMetric(hub, "http_responses_total"), `http_responses_total{class="4xx",code="404",direction="server",method="GET",path="UNMATCHED",service_name="test",target="",type="http-request"} 1`)
+}
+
+func TestFiberMetricsCollectorErrorHandler(t *testing.T) {
+	hub := newTestHub()
+
+	var handled error
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			handled = err
+			if errors.Is(err, fiber.ErrUnprocessableEntity) {
+				return c.SendStatus(fiber.StatusBadRequest)
+			}
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	})
+	app.Use(NewFiberMetricsCollector(hub))
+	// the middleware after the collector does not make a request matched.
+	app.Use("/api", func(c *fiber.Ctx) error {
+		return c.Next()
+	})
+	app.Get("/api/vm/:id", func(c *fiber.Ctx) error {
+		return fiber.ErrConflict
+	})
+	app.Post("/api/vm/:id", func(c *fiber.Ctx) error {
+		return fiber.ErrUnprocessableEntity
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/vm/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+	assert.Equal(t, fiber.ErrConflict, handled)
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/disk/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	// the status is what the error handler responds rather than the code of the error.
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/vm/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	// the routes registered after the first request are matched too.
+	app.Get("/api/disk/:id", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/disk/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+
+	metrics := scrapeMetric(hub, "http_responses_total")
+	assert.Contains(t, metrics, `http_responses_total{class="4xx",code="409",direction="server",method="GET",path="/api/vm/:id",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, metrics, `http_responses_total{class="4xx",code="404",direction="server",method="GET",path="UNMATCHED",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, metrics, `http_responses_total{class="4xx",code="400",direction="server",method="POST",path="/api/vm/:id",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, metrics, `http_responses_total{class="2xx",code="204",direction="server",method="GET",path="/api/disk/:id",service_name="test",target="",type="http-request"} 1`)
+}
@@ -1,46 +1,184 @@
 package middleware
 
 import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
 )
 
+// ginResponseWriter counts the bytes written by the next handlers, and records
+// the time the first byte is written. If a gzip middleware is registered before
+// the collector, the counted bytes are uncompressed, and the size of the wrapped
+// writer is compressed.
+type ginResponseWriter struct {
+	gin.ResponseWriter
+	size        int64
+	firstByteAt time.Time
+
+	streamTracker
+}
+
+// markFirstByte records the time the first byte is written, the header of gin
+// is written by WriteHeaderNow, Write or Flush, rather than WriteHeader.
+func (w *ginResponseWriter) markFirstByte() {
+	if w.firstByteAt.IsZero() {
+		w.firstByteAt = fasttime.Now()
+		w.check(w.Header())
+		if w.Status() == http.StatusSwitchingProtocols {
+			w.switched()
+		}
+	}
+}
+
+// WriteHeaderNow implements gin.ResponseWriter.
+func (w *ginResponseWriter) WriteHeaderNow() {
+	w.markFirstByte()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Hijack implements http.Hijacker.
+func (w *ginResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err == nil {
+		w.switched()
+	}
+	return conn, rw, err
+}
+
+// Flush implements http.Flusher.
+func (w *ginResponseWriter) Flush() {
+	w.markFirstByte()
+	w.ResponseWriter.Flush()
+}
+
+// Write implements http.ResponseWriter.
+func (w *ginResponseWriter) Write(b []byte) (int, error) {
+	w.markFirstByte()
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	w.written(b[:n])
+	return n, err
+}
+
+// WriteString implements io.StringWriter.
+func (w *ginResponseWriter) WriteString(s string) (int, error) {
+	w.markFirstByte()
+	n, err := w.ResponseWriter.WriteString(s)
+	w.size += int64(n)
+	if w.conn != nil {
+		w.written([]byte(s[:n]))
+	}
+	return n, err
+}
+
 // NewGinMetricsCollector creates a Gin middleware to collect HTTP request metrics.
-func NewGinMetricsCollector(hub *metricshub.MetricsHub) gin.HandlerFunc {
+//
+// If a gzip middleware, e.g. gin-contrib/gzip, is registered before the collector, the
+// uncompressed size is exact, but the gzip writer is closed after the collector returns,
+// so the response size misses the compressed bytes flushed by the close. If the collector
+// is registered before the gzip middleware, the response size is exact, but the
+// uncompressed size is unknown.
+func NewGinMetricsCollector(hub *metricshub.MetricsHub, opts ...Option) gin.HandlerFunc {
+	o := newOptions(opts)
+
 	return func(c *gin.Context) {
+		if o.skip(ginContext{c}) {
+			c.Next()
+			return
+		}
+
 		startAt := time.Now()
+		body := wrapBody(c.Request)
+		writer := c.Writer
+		rw := &ginResponseWriter{ResponseWriter: writer}
+		c.Writer = rw
+
+		// The upgraded and SSE connections are tracked as long-lived connections
+		// rather than requests, so they don't skew the request latency.
+		// The route is matched before the middlewares are called.
+		done := sync.OnceFunc(hub.TrackHTTPRequest(c.Request.Method, c.FullPath(), c.Request.URL.Path))
+		defer done()
+		c.Request = rw.track(c.Request, func(kind string) *metricshub.Connection {
+			done()
+			return hub.TrackConnection(kind, hub.RoutePath(c.FullPath(), c.Request.URL.Path, http.StatusOK))
+		})
+
+		// Collect the request even if the handler panics, and re-panic
+		// so the recovery middleware registered before still works.
+		defer func() {
+			if rec := recover(); rec != nil {
+				c.Writer = writer
+				collectGin(hub, o, c, startAt, body, writer, rw, rec)
+				panic(rec)
+			}
+		}()
 
 		// Process the next handler in the chain
 		c.Next()
+		c.Writer = writer
+		collectGin(hub, o, c, startAt, body, writer, rw, nil)
+	}
+}
 
-		// Calculate processing time and extract request details
-		processTime := time.Since(startAt)
-		routePath := c.FullPath() // Use the registered router path directly
-		if hub.IsExcludedHttpPath(routePath) {
-			return
-		}
-		method := c.Request.Method
-		statusCode := c.Writer.Status()
-		bodyBytesReceived := c.Request.ContentLength
-		if bodyBytesReceived < 0 {
-			bodyBytesReceived = 0
-		}
-		bodyBytesSent := int64(c.Writer.Size())
-		if bodyBytesSent < 0 {
-			bodyBytesSent = 0
-		}
+// collectGin collects the metrics of the request, the status code is 500 if
+// the handler panicked with the recovered value.
+func collectGin(hub *metricshub.MetricsHub, o *options, c *gin.Context, startAt time.Time,
+	body *bodyReader, writer gin.ResponseWriter, rw *ginResponseWriter, recovered any) {
+	if rw.conn != nil {
+		rw.conn.Close()
+		return
+	}
 
-		// Prepare the metric data
-		requestMetric := &metricshub.RequestMetric{
-			StatusCode: statusCode,
-			Duration:   processTime,
-			ReqSize:    uint64(bodyBytesReceived),
-			RespSize:   uint64(bodyBytesSent),
-		}
+	// Calculate processing time and extract request details
+	processTime := time.Since(startAt)
+	statusCode := c.Writer.Status()
+	if recovered != nil {
+		statusCode = http.StatusInternalServerError
+	}
+	// Use the registered router path directly
+	routePath := hub.RoutePath(c.FullPath(), c.Request.URL.Path, statusCode)
+	if hub.IsExcludedHttpRequest(c.Request.Method, routePath) {
+		return
+	}
+	routePath = o.group(ginContext{c}, routePath)
+	method := c.Request.Method
+	bodyBytesReceived := requestSize(c.Request, body)
+	bodyBytesSent := uint64(max(writer.Size(), 0))
 
-		// Update metrics in the MetricsHub
-		hub.UpdateHTTPRequestMetrics(requestMetric, method, routePath)
+	// Prepare the metric data
+	requestMetric := &metricshub.RequestMetric{
+		StatusCode: statusCode,
+		Duration:   processTime,
+		ReqSize:    bodyBytesReceived,
+		RespSize:   bodyBytesSent,
+		Header:     c.Writer.Header(),
+		Labels:     o.labels(ginContext{c}),
+		TTFB:       ttfb(startAt, rw.firstByteAt, processTime),
+		QueueTime:  queueTime(c.GetHeader, startAt),
+		RawPath:    c.Request.URL.Path,
+		TraceID:    traceID(c.GetHeader),
 	}
+	if uncompressed := uint64(rw.size); uncompressed != bodyBytesSent {
+		requestMetric.RespUncompressedSize = uncompressed
+	}
+	if o.headerBytes {
+		addHeaderBytes(requestMetric, c.Request)
+	}
+	if len(c.Errors) > 0 {
+		requestMetric.Err = c.Errors.Last()
+	}
+	if recovered != nil {
+		requestMetric.Err = panicError(recovered)
+		requestMetric.Panicked = true
+	}
+
+	// Update metrics in the MetricsHub
+	hub.UpdateHTTPRequestMetrics(requestMetric, method, routePath)
+	o.accessLog.logRequest(c.Request, startAt, method, routePath, requestMetric)
 }
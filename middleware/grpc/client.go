@@ -0,0 +1,215 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	clientHandledTotal     = "grpc_client_handled_total"
+	clientMsgReceivedTotal = "grpc_client_msg_received_total"
+	clientMsgSentTotal     = "grpc_client_msg_sent_total"
+)
+
+type (
+	// clientStream wraps the grpc.ClientStream to count the messages,
+	// and collects the metrics when the stream is finished.
+	clientStream struct {
+		grpc.ClientStream
+
+		serverStreams bool
+		finishOnce    sync.Once
+		finish        func(err error, s *clientStream)
+		// stopAfterCtx stops finishing the stream when its context is done.
+		stopAfterCtx func() bool
+
+		// the messages are sent and received by different goroutines.
+		msgReceived atomic.Uint64
+		msgSent     atomic.Uint64
+		bytesRecv   atomic.Uint64
+		bytesSent   atomic.Uint64
+	}
+)
+
+// UnaryClientInterceptor creates a gRPC unary client interceptor to collect the metrics of
+// the outbound calls, they are collected into the client direction of the hub and labeled
+// by the target of the connection.
+func UnaryClientInterceptor(hub *metricshub.MetricsHub, opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+	grpcMetrics := newClientMetrics(hub, o)
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if o.skip(ctx, method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		path := o.group(ctx, method)
+		startAt := fasttime.Now()
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		processTime := fasttime.Since(startAt)
+
+		respSize := uint64(0)
+		if err == nil {
+			respSize = messageSize(reply)
+		}
+		updateClientRequestMetrics(hub, grpcMetrics, grpcTypeUnary, targetOf(cc), method, path, err,
+			processTime, messageSize(req), respSize, 1, 1)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor creates a gRPC stream client interceptor to collect the metrics of
+// the outbound streams. The duration of a stream is the duration from the stream is created
+// to the last message is received, the stream is failed or its context is done, and the sizes
+// are the total sizes of the messages sent and received.
+func StreamClientInterceptor(hub *metricshub.MetricsHub, opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+	grpcMetrics := newClientMetrics(hub, o)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if o.skip(ctx, method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+
+		startAt := fasttime.Now()
+		target := targetOf(cc)
+		path := o.group(ctx, method)
+		grpcType := streamType(desc.ClientStreams, desc.ServerStreams)
+
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			updateClientRequestMetrics(hub, grpcMetrics, grpcType, target, method, path, err,
+				fasttime.Since(startAt), 0, 0, 0, 0)
+			return nil, err
+		}
+
+		stream := &clientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			finish: func(err error, s *clientStream) {
+				updateClientRequestMetrics(hub, grpcMetrics, grpcType, target, method, path, err,
+					fasttime.Since(startAt), s.bytesSent.Load(), s.bytesRecv.Load(),
+					s.msgSent.Load(), s.msgReceived.Load())
+			},
+		}
+		// The stream cancelled or dropped by the caller before RecvMsg returns
+		// io.EOF or an error is finished by its context.
+		stream.stopAfterCtx = context.AfterFunc(ctx, func() {
+			err := status.FromContextError(ctx.Err()).Err()
+			stream.finishOnce.Do(func() { stream.finish(err, stream) })
+		})
+		return stream, nil
+	}
+}
+
+// SendMsg implements grpc.ClientStream.
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.msgSent.Add(1)
+		s.bytesSent.Add(messageSize(m))
+	}
+	return err
+}
+
+// RecvMsg implements grpc.ClientStream.
+// The stream is finished when io.EOF or an error is received, or the only
+// message of a non-server-streaming call is received.
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.msgReceived.Add(1)
+		s.bytesRecv.Add(messageSize(m))
+		if !s.serverStreams {
+			s.done(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.done(nil)
+	default:
+		s.done(err)
+	}
+	return err
+}
+
+// done finishes the stream once by RecvMsg, and stops finishing it by its context.
+func (s *clientStream) done(err error) {
+	s.stopAfterCtx()
+	s.finishOnce.Do(func() { s.finish(err, s) })
+}
+
+func updateClientRequestMetrics(hub *metricshub.MetricsHub, grpcMetrics *grpcMetrics, grpcType, target, fullMethod, path string,
+	err error, processTime time.Duration, reqSize, respSize, msgSent, msgReceived uint64) {
+	code := status.Code(err)
+	requestMetric := &metricshub.RequestMetric{
+		StatusCode: HTTPStatusFromCode(code),
+		Duration:   processTime,
+		ReqSize:    reqSize,
+		RespSize:   respSize,
+		Err:        err,
+		Cause:      causeFromCode(code),
+	}
+	hub.UpdateClientRequestMetrics(requestMetric, target, http.MethodPost, path)
+
+	labels := methodLabels(grpcType, fullMethod)
+	labels["target"] = target
+	grpcMetrics.update(labels, code, msgReceived, msgSent)
+}
+
+// newClientMetrics creates the gRPC specific client metrics, the metrics created by
+// the other interceptor of the hub are reused. It returns nil if the code mode is not
+// CodeModeGRPC or the metrics cannot be created.
+func newClientMetrics(hub *metricshub.MetricsHub, o *options) *grpcMetrics {
+	if o.codeMode != CodeModeGRPC {
+		return nil
+	}
+	labels := []string{"grpc_type", "grpc_service", "grpc_method", "target"}
+	m, err := newGRPCMetrics(hub, labels,
+		clientHandledTotal, "the total count of gRPC calls completed by the client by the gRPC status code",
+		clientMsgReceivedTotal, "the total count of gRPC stream messages received by the client",
+		clientMsgSentTotal, "the total count of gRPC stream messages sent by the client")
+	if err != nil {
+		log.Printf("create gRPC client metrics failed, only the http metrics are collected: %v", err)
+		return nil
+	}
+	return m
+}
+
+// causeFromCode returns the cause of the failed call, the deadline exceeded and
+// unavailable calls are counted distinctly.
+func causeFromCode(code codes.Code) string {
+	switch code {
+	case codes.DeadlineExceeded:
+		return metricshub.CauseDeadlineExceeded
+	case codes.Unavailable:
+		return metricshub.CauseUnavailable
+	default:
+		return ""
+	}
+}
+
+// targetOf returns the target of the connection without the resolver scheme,
+// e.g. "vm-operator:9090" for "dns:///vm-operator:9090".
+func targetOf(cc *grpc.ClientConn) string {
+	target := cc.Target()
+	if _, after, found := strings.Cut(target, ":///"); found {
+		return after
+	}
+	return target
+}
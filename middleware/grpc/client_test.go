@@ -0,0 +1,128 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClientInterceptors(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	lis, _ := startHealthServer(t)
+	conn := dial(t, lis,
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(hub)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(hub)),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := context.Background()
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	expiredCtx, cancel := context.WithTimeout(ctx, -time.Second)
+	defer cancel()
+	_, err = client.Check(expiredCtx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// the target of a closed listener is unavailable.
+	closed := bufconn.Listen(1024)
+	closed.Close()
+	_, err = healthpb.NewHealthClient(dial(t, closed,
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(hub)),
+	)).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	responses := scrape(hub, "http_responses_total")
+	assert.Contains(t, responses, `http_responses_total{class="2xx",code="200",direction="client",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="4xx",code="404",direction="client",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="5xx",code="504",direction="client",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="5xx",code="503",direction="client",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="4xx",code="499",direction="client",method="POST",path="/grpc.health.v1.Health/Watch",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.NotContains(t, responses, `direction="server"`)
+
+	failures := scrape(hub, "client_request_failures_total")
+	assert.Contains(t, failures, `cause="deadline_exceeded",method="POST",path="/grpc.health.v1.Health/Check"`)
+	assert.Contains(t, failures, `cause="unavailable",method="POST",path="/grpc.health.v1.Health/Check"`)
+	assert.Equal(t, 2, strings.Count(failures, "\n"))
+
+	handled := scrape(hub, clientHandledTotal)
+	assert.Contains(t, handled, `grpc_code="DeadlineExceeded",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",service_name="test",target="bufnet"`)
+	assert.Contains(t, handled, `grpc_code="Canceled",grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream",service_name="test",target="bufnet"`)
+	assert.Contains(t, scrape(hub, clientMsgReceivedTotal), `grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream",service_name="test",target="bufnet",type="grpc"} 1`)
+}
+
+func TestClientStreamCancelled(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	lis, _ := startHealthServer(t)
+	conn := dial(t, lis, grpc.WithStreamInterceptor(StreamClientInterceptor(hub)))
+
+	// the stream is dropped after the first message without receiving the error.
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(scrape(hub, clientHandledTotal), `grpc_code="Canceled",grpc_method="Watch"`)
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, scrape(hub, clientMsgReceivedTotal), `grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream",service_name="test",target="bufnet",type="grpc"} 1`)
+}
+
+func TestClientInterceptorsOptions(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	opts := []Option{
+		WithSkipper(func(ctx context.Context, fullMethod string) bool {
+			return strings.HasSuffix(fullMethod, "/Watch")
+		}),
+		WithGroupPath(func(ctx context.Context, fullMethod string) string {
+			return "/grpc.health.v1.Health/*"
+		}),
+	}
+	lis, _ := startHealthServer(t)
+	conn := dial(t, lis,
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(hub, opts...)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(hub, opts...)),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	responses := scrape(hub, "http_responses_total")
+	assert.Contains(t, responses, `http_responses_total{class="2xx",code="200",direction="client",method="POST",path="/grpc.health.v1.Health/*",service_name="test",target="bufnet",type="http-request"} 1`)
+	assert.Equal(t, 1, strings.Count(responses, "\n"))
+}
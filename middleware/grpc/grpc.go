@@ -0,0 +1,391 @@
+// Package grpc provides the gRPC interceptors to collect the request metrics
+// into the MetricsHub, the gRPC calls are collected as the http requests with
+// the POST method and the full method path, e.g. "/pkg.Service/Method".
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// CodeModeGRPC collects the gRPC status code with the grpc_code label,
+	// in addition to the mapped http status code of the http metrics.
+	CodeModeGRPC CodeMode = iota
+	// CodeModeHTTP only collects the http status code mapped from the gRPC status code.
+	CodeModeHTTP
+)
+
+const (
+	grpcTypeUnary        = "unary"
+	grpcTypeClientStream = "client_stream"
+	grpcTypeServerStream = "server_stream"
+	grpcTypeBidiStream   = "bidi_stream"
+
+	serverHandledTotal     = "grpc_server_handled_total"
+	serverMsgReceivedTotal = "grpc_server_msg_received_total"
+	serverMsgSentTotal     = "grpc_server_msg_sent_total"
+
+	// grpcMetricsType is the type label of the gRPC specific metrics.
+	grpcMetricsType = "grpc"
+)
+
+type (
+	// CodeMode is the mode to collect the gRPC status code.
+	CodeMode int
+
+	// Option configures the gRPC interceptors.
+	Option func(*options)
+
+	options struct {
+		codeMode CodeMode
+
+		skipper     func(ctx context.Context, fullMethod string) bool
+		groupPath   func(ctx context.Context, fullMethod string) string
+		extraLabels []func(ctx context.Context, fullMethod string) map[string]string
+	}
+
+	// grpcMetrics is the gRPC specific metrics of a direction.
+	grpcMetrics struct {
+		handled     *prometheus.CounterVec
+		msgReceived *prometheus.CounterVec
+		msgSent     *prometheus.CounterVec
+	}
+
+	// serverStream wraps the grpc.ServerStream to count the messages.
+	serverStream struct {
+		grpc.ServerStream
+
+		msgReceived uint64
+		msgSent     uint64
+		bytesRecv   uint64
+		bytesSent   uint64
+	}
+)
+
+// WithCodeMode sets the mode to collect the gRPC status code, default is CodeModeGRPC.
+func WithCodeMode(mode CodeMode) Option {
+	return func(o *options) {
+		o.codeMode = mode
+	}
+}
+
+// WithSkipper sets the function to skip the calls, the skipped calls are
+// neither collected nor tracked as in-flight.
+func WithSkipper(fn func(ctx context.Context, fullMethod string) bool) Option {
+	return func(o *options) {
+		o.skipper = fn
+	}
+}
+
+// WithGroupPath sets the function to override the path of the calls, e.g. to group
+// several methods into one, the empty result means the full method is used.
+// The grpc_service and grpc_method labels of the gRPC metrics are not overridden.
+func WithGroupPath(fn func(ctx context.Context, fullMethod string) string) Option {
+	return func(o *options) {
+		o.groupPath = fn
+	}
+}
+
+// WithExtraLabels adds the function to extract the extra labels of the calls, e.g.
+// the tenant from the incoming metadata. It could be set multiple times, the labels
+// are merged. The label keys must be declared in MetricsHubConfig.HTTPExtraLabels,
+// and only the server interceptors collect them.
+func WithExtraLabels(fn func(ctx context.Context, fullMethod string) map[string]string) Option {
+	return func(o *options) {
+		o.extraLabels = append(o.extraLabels, fn)
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// skip returns true if the call should not be collected.
+func (o *options) skip(ctx context.Context, fullMethod string) bool {
+	return o.skipper != nil && o.skipper(ctx, fullMethod)
+}
+
+// group returns the path of the call, it is the full method if the
+// group path hook is not set or returns empty.
+func (o *options) group(ctx context.Context, fullMethod string) string {
+	if o.groupPath == nil {
+		return fullMethod
+	}
+	if group := o.groupPath(ctx, fullMethod); group != "" {
+		return group
+	}
+	return fullMethod
+}
+
+// labels returns the extra labels of the call merged from the extractors,
+// the later extractors override the earlier ones.
+func (o *options) labels(ctx context.Context, fullMethod string) map[string]string {
+	if len(o.extraLabels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, fn := range o.extraLabels {
+		for k, v := range fn(ctx, fullMethod) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// UnaryServerInterceptor creates a gRPC unary server interceptor to collect the request metrics.
+func UnaryServerInterceptor(hub *metricshub.MetricsHub, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	grpcMetrics := newServerMetrics(hub, o)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if o.skip(ctx, info.FullMethod) || hub.IsExcludedHttpRequest(http.MethodPost, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		path := o.group(ctx, info.FullMethod)
+		done := hub.TrackHTTPRequest(http.MethodPost, path, info.FullMethod)
+		defer done()
+
+		startAt := fasttime.Now()
+		resp, err := handler(ctx, req)
+		processTime := fasttime.Since(startAt)
+
+		code := status.Code(err)
+		requestMetric := &metricshub.RequestMetric{
+			StatusCode: HTTPStatusFromCode(code),
+			Duration:   processTime,
+			ReqSize:    messageSize(req),
+			RespSize:   messageSize(resp),
+			Err:        err,
+			Labels:     o.labels(ctx, info.FullMethod),
+		}
+		hub.UpdateHTTPRequestMetrics(requestMetric, http.MethodPost, path)
+		grpcMetrics.update(methodLabels(grpcTypeUnary, info.FullMethod), code, 1, 1)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor creates a gRPC stream server interceptor to collect the request metrics.
+// The duration of a stream is the duration from the stream is created to it is finished,
+// and the sizes are the total sizes of the messages received and sent.
+func StreamServerInterceptor(hub *metricshub.MetricsHub, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	grpcMetrics := newServerMetrics(hub, o)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		if o.skip(ctx, info.FullMethod) || hub.IsExcludedHttpRequest(http.MethodPost, info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		path := o.group(ctx, info.FullMethod)
+		done := hub.TrackHTTPRequest(http.MethodPost, path, info.FullMethod)
+		defer done()
+
+		startAt := fasttime.Now()
+		stream := &serverStream{ServerStream: ss}
+		err := handler(srv, stream)
+		processTime := fasttime.Since(startAt)
+
+		code := status.Code(err)
+		requestMetric := &metricshub.RequestMetric{
+			StatusCode: HTTPStatusFromCode(code),
+			Duration:   processTime,
+			ReqSize:    stream.bytesRecv,
+			RespSize:   stream.bytesSent,
+			Err:        err,
+			Labels:     o.labels(ctx, info.FullMethod),
+		}
+		hub.UpdateHTTPRequestMetrics(requestMetric, http.MethodPost, path)
+		grpcMetrics.update(methodLabels(streamType(info.IsClientStream, info.IsServerStream), info.FullMethod),
+			code, stream.msgReceived, stream.msgSent)
+
+		return err
+	}
+}
+
+// RecvMsg implements grpc.ServerStream.
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.msgReceived++
+		s.bytesRecv += messageSize(m)
+	}
+	return err
+}
+
+// SendMsg implements grpc.ServerStream.
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.msgSent++
+		s.bytesSent += messageSize(m)
+	}
+	return err
+}
+
+// newServerMetrics creates the gRPC specific server metrics, the metrics created by
+// the other interceptor of the hub are reused. It returns nil if the code mode is not
+// CodeModeGRPC or the metrics cannot be created.
+func newServerMetrics(hub *metricshub.MetricsHub, o *options) *grpcMetrics {
+	if o.codeMode != CodeModeGRPC {
+		return nil
+	}
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	m, err := newGRPCMetrics(hub, labels,
+		serverHandledTotal, "the total count of gRPC calls completed on the server by the gRPC status code",
+		serverMsgReceivedTotal, "the total count of gRPC stream messages received on the server",
+		serverMsgSentTotal, "the total count of gRPC stream messages sent on the server")
+	if err != nil {
+		log.Printf("create gRPC server metrics failed, only the http metrics are collected: %v", err)
+		return nil
+	}
+	return m
+}
+
+// newGRPCMetrics creates the counters of the completed calls and the stream messages,
+// they are labeled by the common labels of the hub with the type "grpc".
+func newGRPCMetrics(hub *metricshub.MetricsHub, labels []string,
+	handled, handledHelp, msgReceived, msgReceivedHelp, msgSent, msgSentHelp string) (*grpcMetrics, error) {
+	m := &grpcMetrics{}
+	var errs [3]error
+	m.handled, errs[0] = newCounterVec(hub, handled, handledHelp, append(slices.Clone(labels), "grpc_code"))
+	m.msgReceived, errs[1] = newCounterVec(hub, msgReceived, msgReceivedHelp, labels)
+	m.msgSent, errs[2] = newCounterVec(hub, msgSent, msgSentHelp, labels)
+	if err := errors.Join(errs[:]...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func newCounterVec(hub *metricshub.MetricsHub, name, help string, labels []string) (*prometheus.CounterVec, error) {
+	commonLabels := hub.CommonLabels(grpcMetricsType)
+	vec := hub.NewCounterVec(name, help, append(slices.Sorted(maps.Keys(commonLabels)), labels...))
+	if vec == nil {
+		return nil, fmt.Errorf("invalid metric %s", name)
+	}
+	curried, err := vec.CurryWith(commonLabels)
+	if err != nil {
+		return nil, fmt.Errorf("metric %s: %v", name, err)
+	}
+	return curried, nil
+}
+
+// update updates the metrics of a completed call, the labels are the labels
+// of the method, e.g. grpc_type, grpc_service, grpc_method and target.
+func (m *grpcMetrics) update(labels prometheus.Labels, code codes.Code, msgReceived, msgSent uint64) {
+	if m == nil {
+		return
+	}
+
+	handledLabels := maps.Clone(labels)
+	handledLabels["grpc_code"] = code.String()
+	m.handled.With(handledLabels).Inc()
+	if msgReceived > 0 {
+		m.msgReceived.With(labels).Add(float64(msgReceived))
+	}
+	if msgSent > 0 {
+		m.msgSent.With(labels).Add(float64(msgSent))
+	}
+}
+
+// methodLabels returns the labels of the gRPC method.
+func methodLabels(grpcType, fullMethod string) prometheus.Labels {
+	service, method := splitFullMethod(fullMethod)
+	return prometheus.Labels{
+		"grpc_type":    grpcType,
+		"grpc_service": service,
+		"grpc_method":  method,
+	}
+}
+
+// HTTPStatusFromCode maps the gRPC status code to the http status code.
+// https://github.com/grpc-ecosystem/grpc-gateway/blob/main/runtime/errors.go
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.Unknown:
+		return http.StatusInternalServerError
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DataLoss:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// messageSize returns the size of the proto message, 0 for the others.
+func messageSize(m any) uint64 {
+	if pm, ok := m.(proto.Message); ok {
+		return uint64(proto.Size(pm))
+	}
+	return 0
+}
+
+func streamType(isClientStream, isServerStream bool) string {
+	switch {
+	case isClientStream && isServerStream:
+		return grpcTypeBidiStream
+	case isClientStream:
+		return grpcTypeClientStream
+	default:
+		return grpcTypeServerStream
+	}
+}
+
+// splitFullMethod splits the full method "/pkg.Service/Method" into service and method.
+func splitFullMethod(fullMethod string) (string, string) {
+	service, method, found := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !found {
+		return "unknown", "unknown"
+	}
+	return service, method
+}
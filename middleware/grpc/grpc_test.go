@@ -0,0 +1,184 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// scrape returns the samples of the metric exposed by the hub in the text format.
+func scrape(hub *metricshub.MetricsHub, name string) string {
+	w := httptest.NewRecorder()
+	hub.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var sb strings.Builder
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, name+"{") {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// newHealthServer starts a gRPC health server over bufconn with the server options,
+// and returns a client connected to it.
+func newHealthServer(t *testing.T, opts ...grpc.ServerOption) (*grpc.ClientConn, *health.Server) {
+	lis, healthSrv := startHealthServer(t, opts...)
+	return dial(t, lis), healthSrv
+}
+
+// startHealthServer starts a gRPC health server over bufconn with the server options.
+func startHealthServer(t *testing.T, opts ...grpc.ServerOption) (*bufconn.Listener, *health.Server) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(opts...)
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis, healthSrv
+}
+
+// dial creates a client connected to the bufconn listener with the dial options.
+func dial(t *testing.T, lis *bufconn.Listener, opts ...grpc.DialOption) *grpc.ClientConn {
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestServerInterceptors(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	conn, _ := newHealthServer(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(hub)),
+		grpc.StreamInterceptor(StreamServerInterceptor(hub)),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := context.Background()
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// wait for the server to finish the stream.
+	assert.Eventually(t, func() bool {
+		return strings.Contains(scrape(hub, "http_responses_total"), `path="/grpc.health.v1.Health/Watch"`)
+	}, time.Second, 10*time.Millisecond)
+
+	responses := scrape(hub, "http_responses_total")
+	assert.Contains(t, responses, `http_responses_total{class="2xx",code="200",direction="server",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="4xx",code="404",direction="server",method="POST",path="/grpc.health.v1.Health/Check",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, responses, `http_responses_total{class="4xx",code="499",direction="server",method="POST",path="/grpc.health.v1.Health/Watch",service_name="test",target="",type="http-request"} 1`)
+
+	handled := scrape(hub, serverHandledTotal)
+	assert.Contains(t, handled, `grpc_code="NotFound",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"`)
+	assert.Contains(t, handled, `grpc_code="Canceled",grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream"`)
+	assert.Contains(t, scrape(hub, serverMsgSentTotal), `grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream",service_name="test",type="grpc"} 1`)
+	assert.Contains(t, scrape(hub, serverMsgReceivedTotal), `grpc_method="Watch",grpc_service="grpc.health.v1.Health",grpc_type="server_stream",service_name="test",type="grpc"} 1`)
+}
+
+func TestServerInterceptorsHTTPCodeMode(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	conn, _ := newHealthServer(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(hub, WithCodeMode(CodeModeHTTP))),
+	)
+	_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+
+	assert.Contains(t, scrape(hub, "http_responses_total"), `path="/grpc.health.v1.Health/Check"`)
+	assert.Empty(t, scrape(hub, serverHandledTotal))
+}
+
+func TestServerMetricsConflict(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName:        "test",
+		DisableFixedLabels: true,
+	})
+	// the metric registered by the application has different labels.
+	assert.NoError(t, hub.RegisterMetric(&metricshub.MetricRegistration{
+		Name:      serverHandledTotal,
+		Type:      metricshub.MetricTypeCounterVec,
+		LabelKeys: []string{"code"},
+	}))
+
+	assert.Nil(t, newServerMetrics(hub, newOptions(nil)))
+	assert.Nil(t, newServerMetrics(hub, newOptions([]Option{WithCodeMode(CodeModeHTTP)})))
+	assert.NotNil(t, newClientMetrics(hub, newOptions(nil)))
+}
+
+func TestServerInterceptorsOptions(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName:     "test",
+		HTTPExtraLabels: []string{"tenant"},
+	})
+	opts := []Option{
+		WithSkipper(func(ctx context.Context, fullMethod string) bool {
+			return strings.HasSuffix(fullMethod, "/Watch")
+		}),
+		WithGroupPath(func(ctx context.Context, fullMethod string) string {
+			return "/grpc.health.v1.Health/*"
+		}),
+		WithExtraLabels(func(ctx context.Context, fullMethod string) map[string]string {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return map[string]string{"tenant": strings.Join(md.Get("x-tenant"), ",")}
+		}),
+	}
+	conn, _ := newHealthServer(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(hub, opts...)),
+		grpc.StreamInterceptor(StreamServerInterceptor(hub, opts...)),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "a")
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	cancel()
+
+	responses := scrape(hub, "http_responses_total")
+	assert.Contains(t, responses, `http_responses_total{class="2xx",code="200",direction="server",method="POST",path="/grpc.health.v1.Health/*",service_name="test",target="",tenant="a",type="http-request"} 1`)
+	assert.Equal(t, 1, strings.Count(responses, "\n"))
+	assert.Contains(t, scrape(hub, serverHandledTotal), `grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"`)
+	assert.NotContains(t, scrape(hub, serverHandledTotal), `grpc_method="Watch"`)
+}
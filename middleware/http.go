@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+// NewHTTPMetricsHandler creates a net/http middleware to collect HTTP request metrics.
+// The requests are grouped by the pattern of http.ServeMux (Go 1.22+), or by the
+// route returned by WithRouteFunc. If neither is available, the 404 and 405 requests are
+// grouped into the unmatched route, and the others are grouped by the normalized URL path.
+//
+// The response size is the bytes written through the middleware, so it is compressed if
+// the compression handler is wrapped by the middleware. The uncompressed size is not
+// collected, since the handlers of net/http, chi and gorilla/mux have no response of the
+// framework to count the bytes written before the compression, like Echo does.
+func NewHTTPMetricsHandler(hub *metricshub.MetricsHub, next http.Handler, opts ...Option) http.Handler {
+	o := newOptions(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hctx := &httpContext{r: r, route: earlyRoute(r, next, o)}
+		if o.skip(hctx) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		startAt := fasttime.Now()
+		earlyRoute := hctx.route
+		body := wrapBody(r)
+		rw := newResponseWriter(w)
+
+		// The upgraded and SSE connections are tracked as long-lived connections
+		// rather than requests, so they don't skew the request latency.
+		connRoute := func() string {
+			if earlyRoute != "" {
+				return earlyRoute
+			}
+			return route(hub, r, next, o, http.StatusOK)
+		}
+		done := sync.OnceFunc(hub.TrackHTTPRequest(r.Method, earlyRoute, r.URL.Path))
+		defer done()
+		r = rw.track(r, func(kind string) *metricshub.Connection {
+			done()
+			return hub.TrackConnection(kind, connRoute())
+		})
+
+		collect := func(statusCode int, recovered any) {
+			if rw.conn != nil {
+				rw.conn.Close()
+				return
+			}
+			processTime := fasttime.Since(startAt)
+			routePath := earlyRoute
+			if routePath == "" {
+				routePath = route(hub, r, next, o, statusCode)
+			}
+			method := r.Method
+			if hub.IsExcludedHttpRequest(method, routePath) {
+				return
+			}
+			hctx.route = routePath
+			routePath = o.group(hctx, routePath)
+
+			requestMetric := &metricshub.RequestMetric{
+				StatusCode: statusCode,
+				Duration:   processTime,
+				ReqSize:    requestSize(r, body),
+				RespSize:   uint64(rw.Size()),
+				Header:     rw.Header(),
+				Labels:     o.labels(hctx),
+				TTFB:       ttfb(startAt, rw.FirstByteAt(), processTime),
+				QueueTime:  queueTime(r.Header.Get, startAt),
+				RawPath:    r.URL.Path,
+				TraceID:    traceID(r.Header.Get),
+			}
+			if o.headerBytes {
+				addHeaderBytes(requestMetric, r)
+			}
+			if recovered != nil {
+				requestMetric.Err = panicError(recovered)
+				requestMetric.Panicked = true
+			}
+			hub.UpdateHTTPRequestMetrics(requestMetric, method, routePath)
+			o.accessLog.logRequest(r, startAt, method, routePath, requestMetric)
+		}
+
+		// Collect the request even if the handler panics, and re-panic
+		// so the recovery handler wrapping this one still works.
+		defer func() {
+			if rec := recover(); rec != nil {
+				collect(http.StatusInternalServerError, rec)
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+		collect(rw.Status(), nil)
+	})
+}
+
+// earlyRoute returns the route template of the request before it is served,
+// or empty if it is unknown.
+func earlyRoute(r *http.Request, next http.Handler, o *options) string {
+	if mux, ok := next.(*http.ServeMux); ok {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return patternPath(pattern)
+		}
+		return ""
+	}
+	if o.earlyRoute && o.routeFunc != nil {
+		return o.routeFunc(r)
+	}
+	return ""
+}
+
+// route returns the route template of the request.
+func route(hub *metricshub.MetricsHub, r *http.Request, next http.Handler, o *options, statusCode int) string {
+	pattern := r.Pattern
+	// r.Pattern is set on a copy of the request if it is cloned by
+	// the inner middlewares, so ask the mux directly.
+	if mux, ok := next.(*http.ServeMux); ok && pattern == "" {
+		_, pattern = mux.Handler(r)
+	}
+	if pattern != "" {
+		return patternPath(pattern)
+	}
+
+	if o.routeFunc != nil {
+		pattern = o.routeFunc(r)
+	}
+	return hub.RoutePath(pattern, r.URL.Path, statusCode)
+}
+
+// patternPath strips the method of the http.ServeMux pattern,
+// e.g. "GET /vm/{id}" to "/vm/{id}".
+func patternPath(pattern string) string {
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return strings.TrimLeft(path, " \t")
+	}
+	return pattern
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHub() *metricshub.MetricsHub {
+	return metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+}
+
+// scrape returns the metrics exposed by the hub in the text format.
+func scrape(hub *metricshub.MetricsHub) string {
+	w := httptest.NewRecorder()
+	hub.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return w.Body.String()
+}
+
+// scrapeMetric returns the samples of the metric exposed by the hub in the text format.
+func scrapeMetric(hub *metricshub.MetricsHub, name string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(scrape(hub), "\n") {
+		if strings.HasPrefix(line, name+"{") {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestHTTPMetricsHandler(t *testing.T) {
+	hub := newTestHub()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		assert.NoError(t, http.NewResponseController(w).Flush())
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("POST /vm", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, strings.NewReader("created"))
+	})
+	handler := NewHTTPMetricsHandler(hub, mux)
+
+	for _, id := range []string{"1", "2", "3"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm/"+id, nil))
+		assert.Equal(t, "hello", w.Body.String())
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/vm", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	metrics := scrape(hub)
+	assert.Contains(t, metrics, `http_responses_total{class="2xx",code="200",direction="server",method="GET",path="/vm/{id}",service_name="test",target="",type="http-request"} 3`)
+	assert.Contains(t, metrics, `responses_size_bytes_sum{direction="server",method="GET",path="/vm/{id}",service_name="test",target="",type="http-request"} 15`)
+	assert.Contains(t, metrics, `http_responses_total{class="2xx",code="201",direction="server",method="POST",path="/vm",service_name="test",target="",type="http-request"} 1`)
+	assert.Contains(t, metrics, `requests_size_bytes_sum{direction="server",method="POST",path="/vm",service_name="test",target="",type="http-request"} 2`)
+	assert.Contains(t, metrics, `responses_size_bytes_sum{direction="server",method="POST",path="/vm",service_name="test",target="",type="http-request"} 7`)
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	_, _, err := rw.Hijack()
+	assert.ErrorIs(t, err, http.ErrNotSupported)
+	assert.ErrorIs(t, rw.Push("/a.js", nil), http.ErrNotSupported)
+	assert.Equal(t, http.StatusOK, rw.Status())
+}
+
+func TestHTTPMetricsHandlerInFlight(t *testing.T) {
+	hub := newTestHub()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, scrapeMetric(hub, "in_flight_requests"), `in_flight_requests{method="GET",path="/vm/{id}",service_name="test",type="http-request"} 1`)
+		assert.Contains(t, scrapeMetric(hub, "service_in_flight_requests"), `service_in_flight_requests{service_name="test",type="http-request"} 1`)
+	})
+	handler := NewHTTPMetricsHandler(hub, mux)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/vm/1", nil))
+
+	assert.Contains(t, scrapeMetric(hub, "in_flight_requests"), `in_flight_requests{method="GET",path="/vm/{id}",service_name="test",type="http-request"} 0`)
+	assert.Contains(t, scrapeMetric(hub, "service_in_flight_requests"), `service_in_flight_requests{service_name="test",type="http-request"} 0`)
+}
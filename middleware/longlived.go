@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/metrics-go/metricshub"
+)
+
+// streamTracker detects the SSE responses by the content type when the first byte
+// is written, and the upgraded requests by the 101 response or the hijacked connection,
+// and tracks them as long-lived connections rather than requests.
+type streamTracker struct {
+	// open opens the connection of the kind, it is nil if the detection is disabled.
+	open func(kind string) *metricshub.Connection
+	// upgrade is the kind of the connection the request asks to upgrade to.
+	upgrade string
+	conn    *metricshub.Connection
+	checked bool
+	// newline means the last byte written is a newline, an event of SSE
+	// is terminated by a blank line.
+	newline bool
+}
+
+// check opens the connection if the response is an event stream, it is called
+// before the first byte is written.
+func (t *streamTracker) check(header http.Header) {
+	if t.checked || t.open == nil {
+		return
+	}
+	t.checked = true
+	if isEventStream(header.Get("Content-Type")) {
+		t.conn = t.open(metricshub.ConnectionSSE)
+	}
+}
+
+// track sets the function to open the connection of the request, and returns the
+// request with the context carrying the connection if it asks to upgrade.
+func (t *streamTracker) track(r *http.Request, open func(kind string) *metricshub.Connection) *http.Request {
+	t.upgrade = upgradeKind(r.Header.Get)
+	if t.upgrade == "" {
+		t.open = open
+		return r
+	}
+	ctx, setConn := metricshub.WithConnection(r.Context())
+	t.open = func(kind string) *metricshub.Connection {
+		conn := open(kind)
+		setConn(conn)
+		return conn
+	}
+	return r.WithContext(ctx)
+}
+
+// switched opens the connection when the request is switched to another protocol,
+// i.e. the response is 101 or the connection is hijacked.
+func (t *streamTracker) switched() {
+	if t.conn != nil || t.open == nil {
+		return
+	}
+	t.checked = true
+	kind := t.upgrade
+	if kind == "" {
+		kind = metricshub.ConnectionUpgrade
+	}
+	t.conn = t.open(kind)
+}
+
+// written counts the events and bytes written to the event stream.
+func (t *streamTracker) written(b []byte) {
+	if t.conn == nil || len(b) == 0 {
+		return
+	}
+	events := 0
+	for _, c := range b {
+		switch c {
+		case '\n':
+			if t.newline {
+				events++
+				t.newline = false
+			} else {
+				t.newline = true
+			}
+		case '\r':
+		default:
+			t.newline = false
+		}
+	}
+	t.conn.AddSent(events, len(b))
+}
+
+// upgradeKind returns the kind of the long-lived connection if the request
+// asks to upgrade the protocol, e.g. WebSocket, otherwise it returns empty.
+func upgradeKind(get func(key string) string) string {
+	upgrade := get("Upgrade")
+	if upgrade == "" || !hasToken(get("Connection"), "upgrade") {
+		return ""
+	}
+	if strings.EqualFold(upgrade, "websocket") {
+		return metricshub.ConnectionWebSocket
+	}
+	return metricshub.ConnectionUpgrade
+}
+
+// isEventStream returns true if the content type is the one of Server-Sent Events.
+func isEventStream(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// hasToken returns true if the comma-separated header value contains the token, case-insensitive.
+func hasToken(value, token string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeKind(t *testing.T) {
+	header := http.Header{}
+	assert.Equal(t, "", upgradeKind(header.Get))
+	header.Set("Upgrade", "websocket")
+	assert.Equal(t, "", upgradeKind(header.Get))
+	header.Set("Connection", "keep-alive, Upgrade")
+	assert.Equal(t, metricshub.ConnectionWebSocket, upgradeKind(header.Get))
+	header.Set("Upgrade", "h2c")
+	assert.Equal(t, metricshub.ConnectionUpgrade, upgradeKind(header.Get))
+}
+
+func TestStreamTrackerEvents(t *testing.T) {
+	hub := newTestHub()
+	tracker := &streamTracker{open: func(kind string) *metricshub.Connection {
+		return hub.TrackConnection(kind, "/events")
+	}}
+	tracker.check(http.Header{"Content-Type": {"text/event-stream; charset=utf-8"}})
+	tracker.written([]byte("data: 1\n\ndata: 2\r\n"))
+	tracker.written([]byte("\r\nid: 3\ndata: 3\n"))
+	tracker.written([]byte("\n"))
+	tracker.conn.Close()
+
+	assert.Contains(t, scrapeMetric(hub, "connection_messages_sent_total"), "} 3")
+	assert.Contains(t, scrapeMetric(hub, "active_connections"), "} 0")
+}
+
+func TestGinMetricsCollectorSSE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newTestHub()
+	r := gin.New()
+	r.Use(NewGinMetricsCollector(hub))
+	r.GET("/events", func(c *gin.Context) {
+		for i := 0; i < 2; i++ {
+			c.SSEvent("message", fmt.Sprint(i))
+			c.Writer.Flush()
+		}
+	})
+	r.GET("/vm", func(c *gin.Context) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/vm", nil))
+
+	requests := scrapeMetric(hub, "total_requests")
+	assert.Contains(t, requests, `path="/vm"`)
+	assert.NotContains(t, requests, `path="/events"`)
+	assert.Contains(t, scrapeMetric(hub, "connections_total"), `kind="sse",path="/events"`)
+	assert.Contains(t, scrapeMetric(hub, "connection_messages_sent_total"), "} 2")
+	assert.Contains(t, scrapeMetric(hub, "service_in_flight_requests"), "} 0")
+}
+
+func TestUpgradeRequestNotSwitched(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newTestHub()
+	r := gin.New()
+	r.Use(NewGinMetricsCollector(hub))
+	r.GET("/ws", func(c *gin.Context) {
+		c.String(http.StatusBadRequest, "bad handshake")
+	})
+	r.GET("/h2c", func(c *gin.Context) {
+		c.Status(http.StatusSwitchingProtocols)
+		c.Writer.WriteHeaderNow()
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vm", func(w http.ResponseWriter, r *http.Request) {})
+	handler := NewHTTPMetricsHandler(hub, mux)
+
+	upgrade := func(path, protocol string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", protocol)
+		return req
+	}
+	r.ServeHTTP(httptest.NewRecorder(), upgrade("/ws", "websocket"))
+	r.ServeHTTP(httptest.NewRecorder(), upgrade("/h2c", "h2c"))
+	handler.ServeHTTP(httptest.NewRecorder(), upgrade("/vm", "websocket"))
+
+	requests := scrapeMetric(hub, "total_requests")
+	assert.Contains(t, requests, `path="/ws"`)
+	assert.Contains(t, requests, `path="/vm"`)
+	assert.NotContains(t, requests, `path="/h2c"`)
+	connections := scrapeMetric(hub, "connections_total")
+	assert.Contains(t, connections, `kind="upgrade",path="/h2c"`)
+	assert.NotContains(t, connections, `path="/ws"`)
+	assert.NotContains(t, connections, `path="/vm"`)
+	assert.Contains(t, scrapeMetric(hub, "service_in_flight_requests"), "} 0")
+}
+
+func TestFiberUpgradeRequestNotSwitched(t *testing.T) {
+	hub := newTestHub()
+	app := fiber.New()
+	app.Use(NewFiberMetricsCollector(hub))
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusBadRequest).SendString("bad handshake")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, scrapeMetric(hub, "total_requests"), `path="/ws"`)
+}
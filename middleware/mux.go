@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/megaease/metrics-go/metricshub"
+)
+
+// NewMuxMetricsCollector creates a gorilla/mux middleware to collect HTTP request metrics.
+// The requests are grouped by the path template of the matched route, e.g. "/vm/{id}".
+// It should be registered by Router.Use, so the matched route is available.
+func NewMuxMetricsCollector(hub *metricshub.MetricsHub, opts ...Option) mux.MiddlewareFunc {
+	opts = append([]Option{WithRouteFunc(muxPathTemplate), withEarlyRoute()}, opts...)
+	return func(next http.Handler) http.Handler {
+		return NewHTTPMetricsHandler(hub, next, opts...)
+	}
+}
+
+// muxPathTemplate returns the path template of the route matched by gorilla/mux.
+func muxPathTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return tpl
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxMetricsCollector(t *testing.T) {
+	hub := newTestHub()
+
+	router := mux.NewRouter()
+	router.Use(NewMuxMetricsCollector(hub))
+	router.HandleFunc("/api/vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}).Methods(http.MethodDelete)
+
+	for _, url := range []string{"/api/vm/1", "/api/vm/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, url, nil))
+	}
+
+	metrics := scrape(hub)
+	assert.Contains(t, metrics, `http_responses_total{class="2xx",code="202",direction="server",method="DELETE",path="/api/vm/{id}",service_name="test",target="",type="http-request"} 2`)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import "net/http"
+
+type (
+	// Option configures the metrics middlewares.
+	Option func(*options)
+
+	options struct {
+		routeFunc func(r *http.Request) string
+		// earlyRoute means the routeFunc returns the route before the request
+		// is served, so the in-flight requests could be tracked by the route.
+		earlyRoute bool
+		// headerBytes means the sizes of the requests and responses include the headers.
+		headerBytes bool
+
+		skipper     func(ctx Context) bool
+		groupPath   func(ctx Context) string
+		extraLabels []func(ctx Context) map[string]string
+
+		accessLog *accessLogger
+	}
+)
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// skip returns true if the request should not be collected.
+func (o *options) skip(ctx Context) bool {
+	return o.skipper != nil && o.skipper(ctx)
+}
+
+// group returns the group path of the request, it is the path if
+// the group path hook is not set or returns empty.
+func (o *options) group(ctx Context, path string) string {
+	if o.groupPath == nil {
+		return path
+	}
+	if group := o.groupPath(ctx); group != "" {
+		return group
+	}
+	return path
+}
+
+// labels returns the extra labels of the request merged from the extractors,
+// the later extractors override the earlier ones.
+func (o *options) labels(ctx Context) map[string]string {
+	if len(o.extraLabels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, fn := range o.extraLabels {
+		for k, v := range fn(ctx) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// withEarlyRoute marks the route is known before the request is served.
+func withEarlyRoute() Option {
+	return func(o *options) {
+		o.earlyRoute = true
+	}
+}
+
+// WithHeaderBytes makes the collected sizes of the requests and responses include
+// the bytes of the request line, status line and headers in HTTP/1.1 format.
+func WithHeaderBytes() Option {
+	return func(o *options) {
+		o.headerBytes = true
+	}
+}
+
+// WithRouteFunc sets the function to extract the route template of a net/http request.
+// It is used when the request is not routed by http.ServeMux, e.g. served by a
+// third-party router, so the requests could still be grouped by the route template.
+func WithRouteFunc(fn func(r *http.Request) string) Option {
+	return func(o *options) {
+		o.routeFunc = fn
+	}
+}
+
+// WithSkipper sets the function to skip the requests, the skipped requests
+// are neither collected nor tracked as in-flight. It is called before the
+// request is served, so the route of the Context may be unknown yet.
+func WithSkipper(fn func(ctx Context) bool) Option {
+	return func(o *options) {
+		o.skipper = fn
+	}
+}
+
+// WithGroupPath sets the function to override the group path of the requests,
+// e.g. to group several routes into one. It is called after the request is served
+// and not excluded, the empty result means the route path is used.
+func WithGroupPath(fn func(ctx Context) string) Option {
+	return func(o *options) {
+		o.groupPath = fn
+	}
+}
+
+// WithExtraLabels adds the function to extract the extra labels of the requests,
+// e.g. the tenant from a header. It could be set multiple times, the labels are merged.
+// The label keys must be declared in MetricsHubConfig.HTTPExtraLabels, so the HTTP
+// metrics are created with them, the undeclared keys are ignored.
+func WithExtraLabels(fn func(ctx Context) map[string]string) Option {
+	return func(o *options) {
+		o.extraLabels = append(o.extraLabels, fn)
+	}
+}
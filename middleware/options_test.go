@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTenantHub() *metricshub.MetricsHub {
+	return metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName:     "test",
+		HTTPExtraLabels: []string{"tenant"},
+	})
+}
+
+func tenantOptions() []Option {
+	return []Option{
+		WithSkipper(func(ctx Context) bool {
+			return ctx.Path() == "/healthz"
+		}),
+		WithGroupPath(func(ctx Context) string {
+			if strings.HasPrefix(ctx.Route(), "/vm/") {
+				return "/vm/*"
+			}
+			return ""
+		}),
+		WithExtraLabels(func(ctx Context) map[string]string {
+			return map[string]string{"tenant": ctx.Header("X-Tenant")}
+		}),
+	}
+}
+
+func TestHTTPMetricsHandlerOptions(t *testing.T) {
+	hub := newTenantHub()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vm/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /vm/{id}/disks", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	handler := NewHTTPMetricsHandler(hub, mux, tenantOptions()...)
+
+	for _, path := range []string{"/vm/1", "/vm/2/disks", "/healthz"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Tenant", "acme")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	metrics := scrapeMetric(hub, "total_requests")
+	assert.Equal(t, 1, strings.Count(metrics, "\n"), metrics)
+	assert.Contains(t, metrics, `path="/vm/*"`)
+	assert.Contains(t, metrics, `tenant="acme"`)
+	assert.Contains(t, metrics, "} 2")
+}
+
+func TestGinMetricsCollectorOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newTenantHub()
+	r := gin.New()
+	r.Use(NewGinMetricsCollector(hub, tenantOptions()...))
+	r.GET("/vm/:id", func(c *gin.Context) {})
+	r.GET("/healthz", func(c *gin.Context) {})
+
+	for _, tenant := range []string{"a", "b"} {
+		req := httptest.NewRequest(http.MethodGet, "/vm/1", nil)
+		req.Header.Set("X-Tenant", tenant)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	metrics := scrapeMetric(hub, "total_requests")
+	assert.Equal(t, 2, strings.Count(metrics, "\n"), metrics)
+	assert.Contains(t, metrics, `path="/vm/*",service_name="test",target="",tenant="a"`)
+	assert.Contains(t, metrics, `path="/vm/*",service_name="test",target="",tenant="b"`)
+	assert.NotContains(t, metrics, "/healthz")
+}
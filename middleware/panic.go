@@ -0,0 +1,11 @@
+package middleware
+
+import "fmt"
+
+// panicError converts the value recovered from a panic to an error.
+func panicError(recovered any) error {
+	if err, ok := recovered.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return fmt.Errorf("panic: %v", recovered)
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	fiberrecover "github.com/gofiber/fiber/v2/middleware/recover"
+	echo "github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertPanicCollected asserts the panicked request is collected as a 500 response.
+func assertPanicCollected(t *testing.T, hub *metricshub.MetricsHub, path string, panicked bool) {
+	assert.Contains(t, scrapeMetric(hub, "http_responses_total"), `http_responses_total{class="5xx",code="500",direction="server",method="GET",path="`+path+`",service_name="test",target="",type="http-request"} 1`)
+	if panicked {
+		assert.Contains(t, scrapeMetric(hub, "panics_total"), `panics_total{path="`+path+`",service_name="test",type="http-request"} 1`)
+	} else {
+		assert.Empty(t, scrapeMetric(hub, "panics_total"))
+	}
+}
+
+func TestGinPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, recoveryFirst := range []bool{true, false} {
+		hub := newTestHub()
+		r := gin.New()
+		if recoveryFirst {
+			r.Use(gin.Recovery(), NewGinMetricsCollector(hub))
+		} else {
+			r.Use(NewGinMetricsCollector(hub), gin.Recovery())
+		}
+		r.GET("/vm/:id", func(c *gin.Context) {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm/1", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		// the collector only sees the panic if the recovery is registered before it.
+		assertPanicCollected(t, hub, "/vm/:id", recoveryFirst)
+	}
+}
+
+func TestEchoPanic(t *testing.T) {
+	for _, recoverFirst := range []bool{true, false} {
+		hub := newTestHub()
+		e := echo.New()
+		if recoverFirst {
+			e.Use(echomiddleware.Recover(), NewEchoMetricsCollector(hub))
+		} else {
+			e.Use(NewEchoMetricsCollector(hub), echomiddleware.Recover())
+		}
+		e.GET("/vm/:id", func(c echo.Context) error {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm/1", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assertPanicCollected(t, hub, "/vm/:id", recoverFirst)
+	}
+}
+
+func TestHTTPPanic(t *testing.T) {
+	recovery := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	for _, recoveryFirst := range []bool{true, false} {
+		hub := newTestHub()
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /vm/{id}", func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+
+		var handler http.Handler
+		if recoveryFirst {
+			handler = recovery(NewHTTPMetricsHandler(hub, mux))
+		} else {
+			handler = NewHTTPMetricsHandler(hub, recovery(mux))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vm/1", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assertPanicCollected(t, hub, "/vm/{id}", recoveryFirst)
+	}
+}
+
+func TestFiberPanic(t *testing.T) {
+	for _, recoverFirst := range []bool{true, false} {
+		hub := newTestHub()
+		app := fiber.New()
+		if recoverFirst {
+			app.Use(fiberrecover.New(), NewFiberMetricsCollector(hub))
+		} else {
+			app.Use(NewFiberMetricsCollector(hub), fiberrecover.New())
+		}
+		app.Get("/vm/:id", func(c *fiber.Ctx) error {
+			panic("boom")
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/vm/1", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assertPanicCollected(t, hub, "/vm/:id", recoverFirst)
+	}
+}
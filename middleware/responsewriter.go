@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/megaease/metrics-go/utils/fasttime"
+)
+
+// responseWriter wraps the http.ResponseWriter to capture the status code and
+// the bytes written, and the time the first byte is written. It detects the SSE
+// and the upgraded responses by the embedded streamTracker. It supports http.Flusher, http.Hijacker, http.Pusher and
+// io.ReaderFrom, and implements Unwrap for http.ResponseController.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	size        int64
+	wroteHeader bool
+	hijacked    bool
+	firstByteAt time.Time
+
+	streamTracker
+}
+
+var (
+	_ http.Flusher  = (*responseWriter)(nil)
+	_ http.Hijacker = (*responseWriter)(nil)
+	_ http.Pusher   = (*responseWriter)(nil)
+	_ io.ReaderFrom = (*responseWriter)(nil)
+)
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// Status returns the status code of the response.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Size returns the number of the body bytes written.
+func (w *responseWriter) Size() int64 {
+	return w.size
+}
+
+// FirstByteAt returns the time the header or the first byte of the body is written,
+// it is zero if nothing is written.
+func (w *responseWriter) FirstByteAt() time.Time {
+	return w.firstByteAt
+}
+
+func (w *responseWriter) markFirstByte() {
+	if w.firstByteAt.IsZero() {
+		w.firstByteAt = fasttime.Now()
+		w.check(w.Header())
+	}
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(code int) {
+	w.markFirstByte()
+	// informational headers (except 101) could be written multiple times,
+	// they are not the final status.
+	if !w.wroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+	if code == http.StatusSwitchingProtocols {
+		w.switched()
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.markFirstByte()
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	w.written(b[:n])
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	w.markFirstByte()
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+		if !w.wroteHeader {
+			w.status = http.StatusSwitchingProtocols
+			w.wroteHeader = true
+		}
+		w.switched()
+	}
+	return conn, rw, err
+}
+
+// Push implements http.Pusher.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom implements io.ReaderFrom, so the underlying writer could use
+// sendfile if it supports.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.markFirstByte()
+	w.wroteHeader = true
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{w.ResponseWriter}, src)
+	}
+	w.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, it is used by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writerOnly hides the io.ReaderFrom of the writer to avoid the infinite loop in io.Copy.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queueHeaders are the headers set by the load balancers with the time the
+// request is received, e.g. "t=1700000000.123" by nginx and "t=1700000000123456" by heroku.
+var queueHeaders = []string{"X-Request-Start", "X-Queue-Start"}
+
+// queueTime returns the time the request waits before it is served, the get returns
+// the request header. It returns 0 if the headers are missing or invalid, or the clock
+// of the load balancer is ahead.
+func queueTime(get func(key string) string, startAt time.Time) time.Duration {
+	for _, key := range queueHeaders {
+		value := get(key)
+		if value == "" {
+			continue
+		}
+		receivedAt, ok := parseRequestStart(value)
+		if !ok {
+			continue
+		}
+		return max(startAt.Sub(receivedAt), 0)
+	}
+	return 0
+}
+
+// parseRequestStart parses the time of the request start header, the unit of the
+// unix timestamp is detected by its magnitude, it could be seconds with fractions,
+// milliseconds, microseconds or nanoseconds.
+func parseRequestStart(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "t=")
+
+	if sec, frac, found := strings.Cut(value, "."); found {
+		// parse the fraction as nanoseconds to avoid the rounding errors of float.
+		frac = (frac + "000000000")[:9]
+		s, err1 := strconv.ParseInt(sec, 10, 64)
+		ns, err2 := strconv.ParseUint(frac, 10, 64)
+		if err1 != nil || err2 != nil || s <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(s, int64(ns)), true
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0), true
+	case n < 1e14:
+		return time.UnixMilli(n), true
+	case n < 1e17:
+		return time.UnixMicro(n), true
+	default:
+		return time.Unix(0, n), true
+	}
+}
+
+// ttfb returns the time to first byte, the response is written after the
+// handler returns if the first byte is not written by the handler.
+func ttfb(startAt, firstByteAt time.Time, duration time.Duration) time.Duration {
+	if firstByteAt.IsZero() {
+		return duration
+	}
+	return max(firstByteAt.Sub(startAt), time.Nanosecond)
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequestStart(t *testing.T) {
+	want := time.Unix(1700000000, 123000000)
+	for _, value := range []string{
+		"t=1700000000.123",
+		"1700000000123",
+		"t=1700000000123000",
+		"t=1700000000123000000",
+	} {
+		got, ok := parseRequestStart(value)
+		assert.True(t, ok, value)
+		assert.Equal(t, want.UnixMilli(), got.UnixMilli(), value)
+	}
+
+	got, ok := parseRequestStart("1700000000")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000), got.Unix())
+
+	for _, value := range []string{"", "t=", "abc", "-1", "t=0", "1.x"} {
+		_, ok := parseRequestStart(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestQueueTime(t *testing.T) {
+	startAt := time.Now()
+	header := http.Header{}
+	assert.Equal(t, time.Duration(0), queueTime(header.Get, startAt))
+
+	header.Set("X-Queue-Start", "t="+strconv.FormatInt(startAt.Add(-50*time.Millisecond).UnixMicro(), 10))
+	assert.Equal(t, 50*time.Millisecond, queueTime(header.Get, startAt).Round(time.Millisecond))
+
+	// X-Request-Start is preferred, and the clock skew is ignored.
+	header.Set("X-Request-Start", strconv.FormatInt(startAt.Add(time.Second).UnixMilli(), 10))
+	assert.Equal(t, time.Duration(0), queueTime(header.Get, startAt))
+}
+
+func TestHTTPMetricsHandlerTTFB(t *testing.T) {
+	hub := newTestHub()
+	handler := NewHTTPMetricsHandler(hub, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("X-Request-Start", "t="+strconv.FormatInt(time.Now().Add(-200*time.Millisecond).UnixMilli(), 10))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the header is written immediately, so the ttfb falls into the first bucket.
+	ttfb := scrapeMetric(hub, "ttfb_duration_bucket")
+	assert.True(t, strings.Contains(ttfb, `le="10"} 1`), ttfb)
+	assert.Contains(t, scrapeMetric(hub, "requests_duration_bucket"), `le="10"} 0`)
+	queue := scrapeMetric(hub, "queue_duration_bucket")
+	assert.Contains(t, queue, `le="100"} 0`)
+	assert.Contains(t, queue, `le="400"} 1`)
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import "strings"
+
+// traceID returns the trace ID of the request from the W3C traceparent header,
+// the B3 header or the request ID header, the get returns the request header.
+func traceID(get func(key string) string) string {
+	// traceparent: version-traceid-parentid-flags
+	if parts := strings.Split(get("traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+	if id := get("X-B3-TraceId"); id != "" {
+		return id
+	}
+	return get("X-Request-Id")
+}
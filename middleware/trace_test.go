@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceID(t *testing.T) {
+	header := http.Header{}
+	assert.Equal(t, "", traceID(header.Get))
+	header.Set("X-Request-Id", "req-1")
+	assert.Equal(t, "req-1", traceID(header.Get))
+	header.Set("X-B3-TraceId", "b3")
+	assert.Equal(t, "b3", traceID(header.Get))
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID(header.Get))
+}
@@ -0,0 +1,85 @@
+// Package websocket wraps the gorilla/websocket connections to count the messages
+// and bytes into the long-lived connections tracked by the metrics middlewares.
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/megaease/metrics-go/metricshub"
+)
+
+// Conn wraps websocket.Conn, the messages read by ReadMessage and ReadJSON,
+// and written by WriteMessage and WriteJSON are counted. The control messages
+// and the messages of NextReader and NextWriter are not counted.
+type Conn struct {
+	*websocket.Conn
+	tracker *metricshub.Connection
+}
+
+// Upgrade upgrades the request served by the metrics middlewares to a WebSocket
+// connection by the upgrader, and wraps the connection.
+func Upgrade(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, header http.Header) (*Conn, error) {
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(conn, r), nil
+}
+
+// Wrap wraps the connection upgraded from the request. The messages are not counted
+// if the request is not served by the metrics middlewares, or its path is excluded.
+func Wrap(conn *websocket.Conn, r *http.Request) *Conn {
+	return &Conn{
+		Conn:    conn,
+		tracker: metricshub.ConnectionFromContext(r.Context()),
+	}
+}
+
+// ReadMessage reads a message and counts it.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	messageType, p, err = c.Conn.ReadMessage()
+	if err == nil {
+		c.tracker.AddReceived(1, len(p))
+	}
+	return messageType, p, err
+}
+
+// WriteMessage writes a message and counts it.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	err := c.Conn.WriteMessage(messageType, data)
+	if err == nil && isDataMessage(messageType) {
+		c.tracker.AddSent(1, len(data))
+	}
+	return err
+}
+
+// ReadJSON reads a JSON-encoded message and counts it.
+func (c *Conn) ReadJSON(v any) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteJSON writes the JSON encoding of v as a text message and counts it.
+func (c *Conn) WriteJSON(v any) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, p)
+}
+
+// Close closes the connection and marks the tracked connection is closed,
+// the middleware also marks it when the handler returns.
+func (c *Conn) Close() error {
+	c.tracker.Close()
+	return c.Conn.Close()
+}
+
+func isDataMessage(messageType int) bool {
+	return messageType == websocket.TextMessage || messageType == websocket.BinaryMessage
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/megaease/metrics-go/metricshub"
+	"github.com/megaease/metrics-go/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(hub *metricshub.MetricsHub, name string) string {
+	w := httptest.NewRecorder()
+	hub.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var sb strings.Builder
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, name+"{") {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestConn(t *testing.T) {
+	hub := metricshub.NewMetricsHub(&metricshub.MetricsHubConfig{
+		ServiceName: "test",
+	})
+	upgrader := &websocket.Upgrader{}
+	closed := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		conn, err := Upgrade(upgrader, w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		for {
+			var v map[string]string
+			if err := conn.ReadJSON(&v); err != nil {
+				return
+			}
+			conn.WriteJSON(v)
+		}
+	})
+	server := httptest.NewServer(middleware.NewHTTPMetricsHandler(hub, mux))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"a":"b"}`)))
+		_, p, err := client.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"a":"b"}`, string(p))
+	}
+	assert.Contains(t, scrape(hub, "active_connections"), `kind="websocket",path="/ws",service_name="test",type="http-request"} 1`)
+	client.Close()
+	<-closed
+
+	assert.Contains(t, scrape(hub, "active_connections"), "} 0")
+	assert.Contains(t, scrape(hub, "connection_messages_received_total"), "} 2")
+	assert.Contains(t, scrape(hub, "connection_bytes_sent_total"), "} 18")
+	assert.Empty(t, scrape(hub, "total_requests"))
+}
@@ -116,6 +116,49 @@ func formatTimeZone(buf []byte, t time.Time) int {
 	return 6
 }
 
+var shortMonthNames = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+func formatCommonLog(t time.Time) string {
+	buf := make([]byte, 26)
+
+	y, M, d := t.Date()
+	buf[0] = byte(d)/10 + '0'
+	buf[1] = byte(d)%10 + '0'
+	buf[2] = '/'
+	copy(buf[3:6], shortMonthNames[M-1])
+	buf[6] = '/'
+	buf[7] = byte(y/1000) + '0'
+	buf[8] = byte(y/100%10) + '0'
+	buf[9] = byte(y/10%10) + '0'
+	buf[10] = byte(y%10) + '0'
+	buf[11] = ':'
+
+	h, m, s := t.Clock()
+	buf[12] = byte(h)/10 + '0'
+	buf[13] = byte(h)%10 + '0'
+	buf[14] = ':'
+	buf[15] = byte(m)/10 + '0'
+	buf[16] = byte(m)%10 + '0'
+	buf[17] = ':'
+	buf[18] = byte(s)/10 + '0'
+	buf[19] = byte(s)%10 + '0'
+	buf[20] = ' '
+
+	_, o := t.Zone()
+	o /= 60
+	buf[21] = '+'
+	if o < 0 {
+		buf[21] = '-'
+		o = -o
+	}
+	buf[22] = byte(o/600) + '0'
+	buf[23] = byte(o/60%10) + '0'
+	buf[24] = byte(o%60/10) + '0'
+	buf[25] = byte(o%10) + '0'
+
+	return string(buf)
+}
+
 // Layout is the layout to format a time value
 type Layout int
 
@@ -126,14 +169,18 @@ const (
 	RFC3339Milli
 	// RFC3339Nano is the layout for RFC3339 in nano-second
 	RFC3339Nano
+	// CommonLog is the layout for the Common Log Format, i.e. "02/Jan/2006:15:04:05 -0700"
+	CommonLog
 )
 
-// Format is equivlant with time.Format for layouts: RFC3339, RFC3339Milli and RFC3339Nano,
-// but with better performance
+// Format is equivlant with time.Format for layouts: RFC3339, RFC3339Milli, RFC3339Nano
+// and CommonLog, but with better performance
 func Format(t time.Time, layout Layout) string {
 	d, m := 0, 0
 
 	switch layout {
+	case CommonLog:
+		return formatCommonLog(t)
 	case RFC3339:
 	case RFC3339Milli:
 		d = 4
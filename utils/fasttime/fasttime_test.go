@@ -92,6 +92,16 @@ func TestRFC3339Nano(t *testing.T) {
 	}
 }
 
+func TestCommonLog(t *testing.T) {
+	for _, now := range fmtCases {
+		a := Format(now, CommonLog)
+		b := now.Format("02/Jan/2006:15:04:05 -0700")
+		if a != b {
+			t.Errorf("CommonLog is not correct, should be %s, but get %s", b, a)
+		}
+	}
+}
+
 func BenchmarkStdRFC3339(b *testing.B) {
 	now := time.Now()
 	for i := 0; i < b.N; i++ {
@@ -133,3 +143,17 @@ func BenchmarkRFC3339Nano(b *testing.B) {
 		Format(now, RFC3339Nano)
 	}
 }
+
+func BenchmarkStdCommonLog(b *testing.B) {
+	now := time.Now()
+	for i := 0; i < b.N; i++ {
+		now.Format("02/Jan/2006:15:04:05 -0700")
+	}
+}
+
+func BenchmarkCommonLog(b *testing.B) {
+	now := time.Now()
+	for i := 0; i < b.N; i++ {
+		Format(now, CommonLog)
+	}
+}